@@ -0,0 +1,132 @@
+package iterator
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jcchavezs/gh-iterator/exec"
+	"github.com/jcchavezs/gh-iterator/github"
+)
+
+// TokenSource provides GitHub tokens e.g. short-lived GitHub App installation tokens
+// from github.AppTokenSource.
+type TokenSource = github.TokenSource
+
+// Auth holds the credentials used by all the commands run by the iterator instead of the
+// ambient gh and git authentication. It does not modify the global git config hence runs
+// with different credentials can coexist in the same process.
+//
+// The git credential helper is configured through the GIT_CONFIG_COUNT, GIT_CONFIG_KEY_<n> and
+// GIT_CONFIG_VALUE_<n> environment variables, hence a processor setting GIT_CONFIG_COUNT with
+// exec.Execer.WithEnv drops it. Pass extra config with `git -c` instead.
+type Auth struct {
+	// Token is a GitHub token passed to gh as GH_TOKEN (and GH_ENTERPRISE_TOKEN when
+	// Options.Host is a GitHub Enterprise Server host) and to git as the password of a credential
+	// helper for the HTTPS remotes of the GitHub host only, hence it is not sent to other hosts
+	// e.g. submodule remotes, CloneURL proxies or LFS endpoints.
+	Token string
+	// TokenSource provides the token when it has to be refreshed during the run. The token is
+	// retrieved before processing every repository and takes precedence over Token.
+	TokenSource TokenSource
+	// SSHKeyPath is the path to the private key used by git for SSH remotes.
+	SSHKeyPath string
+}
+
+// resolve returns the authentication with the token retrieved from the token source if any.
+func (a *Auth) resolve(ctx context.Context) (*Auth, error) {
+	if a == nil || a.TokenSource == nil {
+		return a, nil
+	}
+
+	token, err := a.TokenSource.Token(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("getting token: %w", err)
+	}
+
+	return &Auth{Token: token, SSHKeyPath: a.SSHKeyPath}, nil
+}
+
+// scopeListingCache returns the listing cache scoped by the identity of the token source if it is
+// a github.IdentifiedTokenSource, as the gh CLI client only sees the rotating tokens.
+func (a *Auth) scopeListingCache(lc *github.ListingCache) *github.ListingCache {
+	if a == nil || lc == nil || lc.Scope != "" {
+		return lc
+	}
+
+	its, ok := a.TokenSource.(github.IdentifiedTokenSource)
+	if !ok {
+		return lc
+	}
+
+	scoped := *lc
+	scoped.Scope = its.Identity()
+	return &scoped
+}
+
+// tokenCredentialHelper answers git credential requests with the token in GH_TOKEN.
+const tokenCredentialHelper = `!f() { test "$1" = get && echo username=x-access-token && echo "password=$GH_TOKEN"; }; f`
+
+// env returns the environment variables as key-value pairs to apply the authentication for the
+// GitHub host, github.com if empty.
+func (a *Auth) env(host string) []string {
+	if a == nil {
+		return nil
+	}
+
+	var (
+		kv         []string
+		gitConfigs [][2]string
+	)
+
+	if a.Token != "" {
+		kv = append(kv, "GH_TOKEN", a.Token)
+		if isEnterpriseHost(host) {
+			kv = append(kv, "GH_ENTERPRISE_TOKEN", a.Token)
+		} else {
+			host = defaultHost
+		}
+
+		helperKey := fmt.Sprintf("credential.https://%s.helper", host)
+		gitConfigs = append(gitConfigs,
+			// an empty helper resets the helpers inherited from the global config for the host
+			[2]string{helperKey, ""},
+			[2]string{helperKey, tokenCredentialHelper},
+		)
+	}
+
+	if a.SSHKeyPath != "" {
+		kv = append(kv, "GIT_SSH_COMMAND", fmt.Sprintf("ssh -i %s -o IdentitiesOnly=yes", shellQuote(a.SSHKeyPath)))
+	}
+
+	if len(gitConfigs) > 0 {
+		kv = append(kv, "GIT_CONFIG_COUNT", fmt.Sprint(len(gitConfigs)))
+		for i, c := range gitConfigs {
+			kv = append(kv, fmt.Sprintf("GIT_CONFIG_KEY_%d", i), c[0], fmt.Sprintf("GIT_CONFIG_VALUE_%d", i), c[1])
+		}
+	}
+
+	return kv
+}
+
+// defaultHost is the GitHub host used when Options.Host is not set.
+const defaultHost = "github.com"
+
+// isEnterpriseHost checks whether the host is a GitHub Enterprise Server host.
+func isEnterpriseHost(host string) bool {
+	return host != "" && host != defaultHost
+}
+
+// withAuth returns a child execer applying the authentication for the GitHub host if any.
+func withAuth(xr exec.Execer, auth *Auth, host string) exec.Execer {
+	if env := auth.env(host); len(env) > 0 {
+		return xr.WithEnv(env...)
+	}
+
+	return xr
+}
+
+// shellQuote quotes s to be used as a single word in a shell command.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,170 @@
+package iterator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/jcchavezs/gh-iterator/exec"
+	"github.com/jcchavezs/gh-iterator/github"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthEnv(t *testing.T) {
+	t.Run("nil auth", func(t *testing.T) {
+		var auth *Auth
+		require.Empty(t, auth.env(""))
+	})
+
+	t.Run("empty auth", func(t *testing.T) {
+		require.Empty(t, (&Auth{}).env(""))
+	})
+
+	t.Run("ssh key", func(t *testing.T) {
+		env := (&Auth{SSHKeyPath: "/home/me/my keys/id_it's"}).env("")
+		require.Equal(t, []string{"GIT_SSH_COMMAND", `ssh -i '/home/me/my keys/id_it'\''s' -o IdentitiesOnly=yes`}, env)
+	})
+}
+
+func TestWithAuth(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("token is available to gh", func(t *testing.T) {
+		xr := withAuth(exec.NewExecer(t.TempDir()), &Auth{Token: "s3cr3t"}, "")
+
+		out, err := exec.TrimStdout(xr.RunX(ctx, "sh", "-c", "echo $GH_TOKEN:$GH_ENTERPRISE_TOKEN"))
+		requireNoErrorAndPrintStderr(t, err)
+		require.Equal(t, "s3cr3t:", out)
+	})
+
+	t.Run("enterprise token is only set for enterprise hosts", func(t *testing.T) {
+		xr := withAuth(exec.NewExecer(t.TempDir()), &Auth{Token: "s3cr3t"}, "github.example.com")
+
+		out, err := exec.TrimStdout(xr.RunX(ctx, "sh", "-c", "echo $GH_TOKEN:$GH_ENTERPRISE_TOKEN"))
+		requireNoErrorAndPrintStderr(t, err)
+		require.Equal(t, "s3cr3t:s3cr3t", out)
+	})
+
+	credentialFill := func(t *testing.T, xr exec.Execer, host string) string {
+		t.Helper()
+
+		// an empty credential helper answers for the hosts without token instead of prompting
+		xr = xr.WithEnv("GIT_TERMINAL_PROMPT", "0", "GIT_ASKPASS", "true", "SSH_ASKPASS", "true")
+		out, err := xr.RunWithStdinX(ctx, strings.NewReader("protocol=https\nhost="+host+"\n\n"), "git", "credential", "fill")
+		requireNoErrorAndPrintStderr(t, err)
+		return out
+	}
+
+	t.Run("token is used by git credential helper", func(t *testing.T) {
+		out := credentialFill(t, withAuth(exec.NewExecer(t.TempDir()), &Auth{Token: "s3cr3t"}, ""), "github.com")
+		require.Contains(t, out, "username=x-access-token\n")
+		require.Contains(t, out, "password=s3cr3t\n")
+	})
+
+	t.Run("token is not sent to other hosts", func(t *testing.T) {
+		xr := withAuth(exec.NewExecer(t.TempDir()), &Auth{Token: "s3cr3t"}, "github.example.com")
+
+		out := credentialFill(t, xr, "github.example.com")
+		require.Contains(t, out, "password=s3cr3t\n")
+
+		out = credentialFill(t, xr, "github.com")
+		require.NotContains(t, out, "s3cr3t")
+
+		out = credentialFill(t, xr, "proxy.example.com")
+		require.NotContains(t, out, "s3cr3t")
+	})
+
+	t.Run("different identities in the same process", func(t *testing.T) {
+		dir := t.TempDir()
+		xr1 := withAuth(exec.NewExecer(dir), &Auth{Token: "token-1"}, "")
+		xr2 := withAuth(exec.NewExecer(dir), &Auth{Token: "token-2"}, "")
+
+		out, err := exec.TrimStdout(xr1.RunX(ctx, "sh", "-c", "echo $GH_TOKEN"))
+		requireNoErrorAndPrintStderr(t, err)
+		require.Equal(t, "token-1", out)
+
+		out, err = exec.TrimStdout(xr2.RunX(ctx, "sh", "-c", "echo $GH_TOKEN"))
+		requireNoErrorAndPrintStderr(t, err)
+		require.Equal(t, "token-2", out)
+	})
+}
+
+type tokenSourceFunc func(ctx context.Context) (string, error)
+
+func (f tokenSourceFunc) Token(ctx context.Context) (string, error) {
+	return f(ctx)
+}
+
+func TestAuthResolve(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("without token source", func(t *testing.T) {
+		auth := &Auth{Token: "s3cr3t"}
+		resolved, err := auth.resolve(ctx)
+		require.NoError(t, err)
+		require.Same(t, auth, resolved)
+	})
+
+	t.Run("token source takes precedence", func(t *testing.T) {
+		calls := 0
+		auth := &Auth{
+			Token:      "s3cr3t",
+			SSHKeyPath: "/id_rsa",
+			TokenSource: tokenSourceFunc(func(context.Context) (string, error) {
+				calls++
+				return fmt.Sprintf("token-%d", calls), nil
+			}),
+		}
+
+		resolved, err := auth.resolve(ctx)
+		require.NoError(t, err)
+		require.Equal(t, &Auth{Token: "token-1", SSHKeyPath: "/id_rsa"}, resolved)
+
+		resolved, err = auth.resolve(ctx)
+		require.NoError(t, err)
+		require.Equal(t, "token-2", resolved.Token)
+	})
+
+	t.Run("token source error", func(t *testing.T) {
+		tsErr := errors.New("bad credentials")
+		_, err := (&Auth{TokenSource: tokenSourceFunc(func(context.Context) (string, error) {
+			return "", tsErr
+		})}).resolve(ctx)
+		require.ErrorIs(t, err, tsErr)
+	})
+}
+
+type identifiedTokenSource struct {
+	tokenSourceFunc
+	identity string
+}
+
+func (s identifiedTokenSource) Identity() string {
+	return s.identity
+}
+
+func TestAuthScopeListingCache(t *testing.T) {
+	ts := tokenSourceFunc(func(context.Context) (string, error) { return "token", nil })
+	lc := &github.ListingCache{Dir: "listings"}
+
+	t.Run("identified token source", func(t *testing.T) {
+		scoped := (&Auth{TokenSource: identifiedTokenSource{ts, "app:1 installation:2"}}).scopeListingCache(lc)
+		require.Equal(t, &github.ListingCache{Dir: "listings", Scope: "app:1 installation:2"}, scoped)
+		require.Empty(t, lc.Scope)
+	})
+
+	t.Run("explicit scope", func(t *testing.T) {
+		scopedLC := &github.ListingCache{Scope: "my-scope"}
+		require.Same(t, scopedLC, (&Auth{TokenSource: identifiedTokenSource{ts, "app:1 installation:2"}}).scopeListingCache(scopedLC))
+	})
+
+	t.Run("token source without identity", func(t *testing.T) {
+		require.Same(t, lc, (&Auth{TokenSource: ts}).scopeListingCache(lc))
+	})
+
+	t.Run("no auth", func(t *testing.T) {
+		require.Same(t, lc, (*Auth)(nil).scopeListingCache(lc))
+	})
+}
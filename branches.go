@@ -0,0 +1,136 @@
+package iterator
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/jcchavezs/gh-iterator/exec"
+	"github.com/jcchavezs/gh-iterator/internal/log"
+)
+
+type branchKey struct{}
+
+// BranchFromContext returns the branch being processed when running with Options.Branches.
+func BranchFromContext(ctx context.Context) (string, bool) {
+	b, ok := ctx.Value(branchKey{}).(string)
+	return b, ok
+}
+
+// listMatchingBranches lists the remote branches matching any of the patterns.
+func listMatchingBranches(ctx context.Context, xr exec.Execer, patterns []string, retryOpts *RetryOptions) ([]string, error) {
+	var res string
+	err := retry(ctx, retryOpts, "listing branches", func() (err error) {
+		res, err = xr.RunX(ctx, "git", "ls-remote", "--heads", "origin")
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("listing branches: %w", err)
+	}
+
+	var branches []string
+
+	ls := bufio.NewScanner(strings.NewReader(res))
+	for ls.Scan() {
+		_, ref, ok := strings.Cut(ls.Text(), "\t")
+		if !ok {
+			continue
+		}
+
+		branch := strings.TrimPrefix(ref, "refs/heads/")
+		for _, p := range patterns {
+			matched, err := path.Match(p, branch)
+			if err != nil {
+				return nil, fmt.Errorf("matching branch pattern %q: %w", p, err)
+			}
+
+			if matched {
+				branches = append(branches, branch)
+				break
+			}
+		}
+	}
+
+	if err := ls.Err(); err != nil {
+		return nil, fmt.Errorf("scanning branches: %w", err)
+	}
+
+	return branches, nil
+}
+
+// processBranches clones the repository once and runs the processor on a worktree for every
+// branch matching Options.Branches.
+func processBranches(ctx context.Context, repo Repository, processor Processor, opts RunOptions) error {
+	logger := log.FromCtx(ctx)
+
+	rootDir := path.Join(reposDir, repo.Name+"-branches_"+randSequence(9))
+	baseDir := path.Join(rootDir, "base")
+	if err := os.MkdirAll(baseDir, os.ModePerm); err != nil {
+		return fmt.Errorf("creating cloning directory: %w", err)
+	}
+	defer os.RemoveAll(rootDir) //nolint:errcheck
+
+	xr := newCloneExecer(baseDir, logger, opts.Auth, opts.Host)
+	if err := initRepository(ctx, xr, repo, baseDir, opts); err != nil {
+		return err
+	}
+
+	branches, err := listMatchingBranches(ctx, xr, opts.Branches, opts.Retry)
+	if err != nil {
+		return err
+	}
+
+	if len(branches) == 0 {
+		return fmt.Errorf("%w: no branch matches %s", errRefNotFound, strings.Join(opts.Branches, ", "))
+	}
+
+	logger.Debug("Processing branches", "branches", branches)
+
+	fetchArgs := []string{"fetch", "origin"}
+	for _, b := range branches {
+		fetchArgs = append(fetchArgs, fmt.Sprintf("refs/heads/%s:refs/remotes/origin/%s", b, b))
+	}
+
+	err = retry(ctx, opts.Retry, "fetching branches", func() error {
+		_, err := xr.RunX(ctx, "git", fetchArgs...)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("fetching branches: %w", err)
+	}
+
+	// HEAD in the base clone points to an unborn branch which could collide with one of the
+	// branches checked out in the worktrees, hence we detach it.
+	if _, err := xr.RunX(ctx, "git", "update-ref", "--no-deref", "HEAD", "refs/remotes/origin/"+branches[0]); err != nil {
+		return fmt.Errorf("detaching HEAD: %w", err)
+	}
+
+	for _, b := range branches {
+		branchDir := path.Join(rootDir, "branches", b)
+		if err := addWorktree(ctx, xr, branchDir, "refs/remotes/origin/"+b, opts, "-B", b); err != nil {
+			return fmt.Errorf("checking out branch %q: %w", b, err)
+		}
+
+		branchLogger := logger.With("branch", b)
+		branchCtx, err := withCheckedOutRepositoryInfo(context.WithValue(log.NewCtx(ctx, branchLogger), branchKey{}, b), repo, branchDir)
+		if err != nil {
+			return fmt.Errorf("checking out branch %q: %w", b, err)
+		}
+
+		branchXr := withHost(withAuth(exec.NewExecerWithLogger(branchDir, branchLogger), opts.Auth, opts.Host), opts.Host)
+		if err := opts.Hooks.afterClone(branchCtx, repo, branchXr); err != nil {
+			return fmt.Errorf("processing branch %q: %w", b, err)
+		}
+
+		if err := runProcessor(branchCtx, repo, processor, false, branchXr, opts.Hooks); err != nil {
+			return fmt.Errorf("processing branch %q: %w", b, err)
+		}
+
+		removeWorktree(ctx, xr, branchDir)
+	}
+
+	return nil
+}
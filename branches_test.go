@@ -0,0 +1,86 @@
+package iterator
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/jcchavezs/gh-iterator/exec"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProcessBranches(t *testing.T) {
+	ctx := context.Background()
+	repo := Repository{Name: "org/repo", SSHURL: createBareRepo(t), DefaultBranchName: "main", Size: 1}
+
+	t.Run("runs processor once per matching branch", func(t *testing.T) {
+		var (
+			mux      sync.Mutex
+			messages = map[string]string{}
+		)
+
+		err := processRepository(ctx, repo, func(ctx context.Context, repository string, isEmpty bool, xr exec.Execer) error {
+			branch, ok := BranchFromContext(ctx)
+			require.True(t, ok)
+
+			msg, err := exec.TrimStdout(xr.RunX(ctx, "git", "log", "-1", "--format=%s"))
+			if err != nil {
+				return err
+			}
+
+			current, err := exec.TrimStdout(xr.RunX(ctx, "git", "rev-parse", "--abbrev-ref", "HEAD"))
+			if err != nil {
+				return err
+			}
+			require.Equal(t, branch, current)
+
+			mux.Lock()
+			defer mux.Unlock()
+			messages[branch] = msg
+
+			return nil
+		}, RunOptions{Branches: []string{"main", "release-*"}})
+		requireNoErrorAndPrintStderr(t, err)
+
+		require.Equal(t, map[string]string{
+			"main":      "initial commit",
+			"release-1": "release commit",
+		}, messages)
+	})
+
+	t.Run("applies the cloning subset", func(t *testing.T) {
+		err := processRepository(ctx, repo, func(ctx context.Context, repository string, isEmpty bool, xr exec.Execer) error {
+			fs := xr.GenerateFS()
+
+			_, err := fs.Stat("README.md")
+			require.NoError(t, err)
+
+			_, err = fs.Stat(filepath.Join("docs", "guide.md"))
+			require.ErrorIs(t, err, os.ErrNotExist)
+
+			return nil
+		}, RunOptions{Branches: []string{"release-*"}, CloningSubset: []string{"README.md"}})
+		requireNoErrorAndPrintStderr(t, err)
+	})
+
+	t.Run("no matching branches", func(t *testing.T) {
+		err := processRepository(ctx, repo, func(context.Context, string, bool, exec.Execer) error {
+			require.Fail(t, "processor should not be called")
+			return nil
+		}, RunOptions{Branches: []string{"feature-*"}})
+		require.ErrorIs(t, err, errRefNotFound)
+	})
+
+	t.Run("after clone hook failure", func(t *testing.T) {
+		err := processRepository(ctx, repo, func(context.Context, string, bool, exec.Execer) error {
+			require.Fail(t, "processor should not be called")
+			return nil
+		}, RunOptions{Branches: []string{"main"}, Hooks: Hooks{
+			AfterClone: func(ctx context.Context, r Repository, xr exec.Execer) error { return errors.New("no identity") },
+		}})
+		require.EqualError(t, err, `processing branch "main": running after clone hook: no identity`)
+	})
+}
@@ -0,0 +1,208 @@
+package iterator
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"sync"
+
+	"github.com/jcchavezs/gh-iterator/exec"
+	"github.com/jcchavezs/gh-iterator/internal/log"
+)
+
+// CacheCopyStrategy represents the strategy to duplicate a cached clone for every use.
+type CacheCopyStrategy int
+
+const (
+	// CacheCopyRecursive copies the cached clone with `cp -r`.
+	CacheCopyRecursive CacheCopyStrategy = iota
+	// CacheCopyReflink copies the cached clone with `cp -r --reflink=auto` which shares the data
+	// blocks on filesystems supporting copy-on-write e.g. btrfs, XFS.
+	CacheCopyReflink
+	// CacheCopyWorktree checks out the cached clone HEAD in a new detached git worktree. The
+	// worktree shares the object store with the cached clone, including the LFS objects, and
+	// clones its submodules from the ones in the cached clone. Worktrees also share the branches
+	// hence a branch cannot be checked out by two concurrent processors e.g. both running
+	// `git checkout -b fix`, use CacheCopyShared when the processor creates branches.
+	CacheCopyWorktree
+	// CacheCopyShared clones the cached clone with `git clone --shared` and points origin to the
+	// remote of the cached clone. The clone borrows the objects of the cached clone, including the
+	// LFS objects, and clones its submodules from the ones in the cached clone like
+	// CacheCopyWorktree but has its own branches.
+	CacheCopyShared
+)
+
+func (s CacheCopyStrategy) String() string {
+	switch s {
+	case CacheCopyReflink:
+		return "reflink"
+	case CacheCopyWorktree:
+		return "worktree"
+	case CacheCopyShared:
+		return "shared"
+	default:
+		return "recursive"
+	}
+}
+
+// copyCachedClone duplicates the cached clone in cloneDir into repoDir using the strategy in opts
+// and returns a function to clean repoDir up. If the strategy fails it falls back to a recursive copy.
+func copyCachedClone(ctx context.Context, cloneDir, repoDir string, opts RunOptions) (func(), error) {
+	logger := log.FromCtx(ctx).With("strategy", opts.CacheCopyStrategy.String())
+
+	removeRepoDir := func() {
+		if err := os.RemoveAll(repoDir); err != nil {
+			logger.Warn("Failed to remove the repo directory", "error", err)
+		}
+	}
+
+	xr := exec.NewExecerWithLogger(reposDir, logger)
+
+	switch opts.CacheCopyStrategy {
+	case CacheCopyWorktree:
+		cxr := newCloneExecer(cloneDir, logger, opts.Auth, opts.Host)
+
+		// the submodules and LFS objects fetched in the cached clone are reused instead of
+		// fetching them again for every worktree
+		worktreeOpts := opts
+		worktreeOpts.Submodules, worktreeOpts.LFS = SubmodulesNone, LFSSkip
+
+		err := addWorktree(ctx, cxr, repoDir, "HEAD", worktreeOpts, "--detach")
+		if err == nil {
+			err = completeCheckoutFromClone(ctx, cxr, newCloneExecer(repoDir, logger, opts.Auth, opts.Host), opts)
+		}
+
+		if err == nil {
+			return func() { removeWorktree(context.WithoutCancel(ctx), cxr, repoDir) }, nil
+		}
+
+		logger.Warn("Failed to add worktree from cached clone, falling back to copy", "error", err)
+		removeWorktree(ctx, cxr, repoDir)
+	case CacheCopyShared:
+		err := cloneShared(ctx, cloneDir, repoDir, opts)
+		if err == nil {
+			return removeRepoDir, nil
+		}
+
+		logger.Warn("Failed to clone cached clone, falling back to copy", "error", err)
+		removeRepoDir()
+	case CacheCopyReflink:
+		_, err := xr.RunX(ctx, "cp", "-r", "--reflink=auto", cloneDir, repoDir)
+		if err == nil {
+			return removeRepoDir, nil
+		}
+
+		logger.Warn("Failed to reflink cached clone, falling back to copy", "error", err)
+		removeRepoDir()
+	}
+
+	if _, err := xr.RunX(ctx, "cp", "-r", cloneDir, repoDir); err != nil {
+		removeRepoDir()
+		return nil, fmt.Errorf("copying repository %w", err)
+	}
+
+	return removeRepoDir, nil
+}
+
+// cloneShared clones the cached clone in cloneDir into repoDir borrowing its objects and checks
+// out its HEAD, applying the cloning subset, submodules and LFS options.
+func cloneShared(ctx context.Context, cloneDir, repoDir string, opts RunOptions) error {
+	logger := log.FromCtx(ctx)
+	cxr := newCloneExecer(cloneDir, logger, opts.Auth, opts.Host)
+
+	originURL, err := exec.TrimStdout(cxr.RunX(ctx, "git", "remote", "get-url", "origin"))
+	if err != nil {
+		return withStderr("getting origin of cached clone", err)
+	}
+
+	head, err := exec.TrimStdout(cxr.RunX(ctx, "git", "rev-parse", "HEAD"))
+	if err != nil {
+		return withStderr("getting HEAD of cached clone", err)
+	}
+
+	if _, err := exec.NewExecerWithLogger(reposDir, logger).RunX(ctx, "git", "clone", "--shared", "--no-checkout", "--quiet", cloneDir, repoDir); err != nil {
+		return withStderr("cloning cached clone", err)
+	}
+
+	sxr := newCloneExecer(repoDir, logger, opts.Auth, opts.Host)
+	if _, err := sxr.RunX(ctx, "git", "remote", "set-url", "origin", originURL); err != nil {
+		return withStderr("setting origin", err)
+	}
+
+	// the clone checks out a branch of the cached clone even when its HEAD is detached e.g. on a tag
+	if _, err := sxr.RunX(ctx, "git", "update-ref", "--no-deref", "HEAD", head); err != nil {
+		return withStderr("setting HEAD", err)
+	}
+
+	if opts.LFS != LFSSkip {
+		// LFS objects are not borrowed through the git alternates hence the storage is shared
+		if _, err := sxr.RunX(ctx, "git", "config", "lfs.storage", path.Join(cloneDir, ".git", "lfs")); err != nil {
+			return withStderr("sharing LFS objects", err)
+		}
+	}
+
+	if len(opts.CloningSubset) > 0 {
+		if _, err := sxr.RunX(ctx, "git", "config", "core.sparseCheckout", "true"); err != nil {
+			return fmt.Errorf("setting sparse checkout subset: %w", err)
+		}
+
+		if err := checkoutWorktreeSubset(ctx, sxr, opts.CloningSubset); err != nil {
+			return err
+		}
+	} else if _, err := sxr.RunX(ctx, "git", "reset", "--hard", "--quiet"); err != nil {
+		return withStderr("checking out cached clone", err)
+	}
+
+	return completeCheckoutFromClone(ctx, cxr, sxr, opts)
+}
+
+// keyedMutex is a set of mutexes identified by a key that can be acquired until the
+// context is done. The mutexes are deleted once no one holds or waits for them.
+type keyedMutex struct {
+	mux   sync.Mutex
+	locks map[string]*keyedLock
+}
+
+// keyedLock is the mutex of a key along with the number of callers holding or waiting for it.
+type keyedLock struct {
+	c    chan struct{}
+	refs int
+}
+
+// lock acquires the mutex for key and returns the function to release it.
+func (km *keyedMutex) lock(ctx context.Context, key string) (func(), error) {
+	km.mux.Lock()
+	if km.locks == nil {
+		km.locks = map[string]*keyedLock{}
+	}
+
+	l, ok := km.locks[key]
+	if !ok {
+		l = &keyedLock{c: make(chan struct{}, 1)}
+		km.locks[key] = l
+	}
+	l.refs++
+	km.mux.Unlock()
+
+	select {
+	case l.c <- struct{}{}:
+		return func() {
+			<-l.c
+			km.release(key, l)
+		}, nil
+	case <-ctx.Done():
+		km.release(key, l)
+		return nil, ctx.Err()
+	}
+}
+
+// release drops a reference to the mutex of key, deleting it when it was the last one.
+func (km *keyedMutex) release(key string, l *keyedLock) {
+	km.mux.Lock()
+	defer km.mux.Unlock()
+
+	if l.refs--; l.refs == 0 {
+		delete(km.locks, key)
+	}
+}
@@ -0,0 +1,320 @@
+package iterator
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jcchavezs/gh-iterator/exec"
+	"github.com/jcchavezs/gh-iterator/exec/mock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestRepository returns a repository with a unique name pointing to a local bare repository
+// and removes its clones from the repos directory after the test.
+func newTestRepository(t *testing.T) Repository {
+	t.Helper()
+
+	owner := "test-" + randSequence(9)
+	t.Cleanup(func() {
+		require.NoError(t, os.RemoveAll(path.Join(reposDir, owner)))
+	})
+
+	return Repository{
+		Name:              owner + "/repo",
+		SSHURL:            createBareRepo(t),
+		DefaultBranchName: "main",
+		Size:              1,
+	}
+}
+
+func TestCloneRepositoryOrGetFromCacheStrategies(t *testing.T) {
+	ctx := context.Background()
+
+	for _, strategy := range []CacheCopyStrategy{CacheCopyRecursive, CacheCopyReflink, CacheCopyWorktree, CacheCopyShared} {
+		t.Run(strategy.String(), func(t *testing.T) {
+			repo := newTestRepository(t)
+			opts := RunOptions{
+				CloneCacheKey:     CloneCacheKeyFromString("key"),
+				CacheCopyStrategy: strategy,
+				CloningSubset:     []string{"README.md"},
+			}
+
+			var dirs []string
+			for range 2 {
+				repoDir, cleanup, err := cloneRepositoryOrGetFromCache(ctx, repo, opts)
+				requireNoErrorAndPrintStderr(t, err)
+				dirs = append(dirs, repoDir)
+
+				require.Equal(t, "initial commit", headCommitMessage(t, repoDir))
+				require.FileExists(t, filepath.Join(repoDir, "README.md"))
+				require.NoFileExists(t, filepath.Join(repoDir, "docs", "guide.md"))
+
+				if strategy == CacheCopyWorktree {
+					// worktrees hold a .git file pointing to the cached clone
+					require.FileExists(t, filepath.Join(repoDir, ".git"))
+				} else if strategy == CacheCopyShared {
+					// shared clones borrow the objects of the cached clone
+					require.FileExists(t, filepath.Join(repoDir, ".git", "objects", "info", "alternates"))
+				} else {
+					require.DirExists(t, filepath.Join(repoDir, ".git"))
+				}
+
+				cleanup()
+				require.NoDirExists(t, repoDir)
+			}
+
+			require.NotEqual(t, dirs[0], dirs[1])
+			require.True(t, strings.HasPrefix(dirs[0], path.Join(reposDir, repo.Name+"-key")))
+		})
+	}
+}
+
+func TestCloneRepositoryOrGetFromCacheReusesSubmodules(t *testing.T) {
+	ctx := context.Background()
+
+	for _, strategy := range []CacheCopyStrategy{CacheCopyWorktree, CacheCopyShared} {
+		t.Run(strategy.String(), func(t *testing.T) {
+			repo := newTestRepository(t)
+			repo.SSHURL = createBareRepoWithSubmodule(t)
+			opts := RunOptions{
+				CloneCacheKey:     CloneCacheKeyFromString("key"),
+				CacheCopyStrategy: strategy,
+				Submodules:        SubmodulesRecursive,
+			}
+
+			repoDir, cleanup, err := cloneRepositoryOrGetFromCache(ctx, repo, opts)
+			requireNoErrorAndPrintStderr(t, err)
+			require.FileExists(t, filepath.Join(repoDir, "lib", "README.md"))
+			cleanup()
+
+			// the submodule remote becomes unreachable, the copies clone it from the cached clone
+			cloneDir := path.Join(reposDir, repo.Name+"-key-s2l0")
+			libURL, err := exec.TrimStdout(exec.NewExecer(cloneDir).RunX(ctx, "git", "config", "submodule.lib.url"))
+			requireNoErrorAndPrintStderr(t, err)
+			require.NoError(t, os.Rename(libURL, libURL+".moved"))
+
+			repoDir, cleanup, err = cloneRepositoryOrGetFromCache(ctx, repo, opts)
+			requireNoErrorAndPrintStderr(t, err)
+			defer cleanup()
+
+			if strategy == CacheCopyShared {
+				require.FileExists(t, filepath.Join(repoDir, ".git", "objects", "info", "alternates"))
+			}
+			require.FileExists(t, filepath.Join(repoDir, "lib", "README.md"))
+		})
+	}
+}
+
+func TestCloneRepositoryOrGetFromCacheSharedBranches(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestRepository(t)
+	opts := RunOptions{
+		CloneCacheKey:     CloneCacheKeyFromString("key"),
+		CacheCopyStrategy: CacheCopyShared,
+	}
+
+	// concurrent processors create the same branch
+	for range 2 {
+		repoDir, cleanup, err := cloneRepositoryOrGetFromCache(ctx, repo, opts)
+		requireNoErrorAndPrintStderr(t, err)
+		defer cleanup()
+
+		require.FileExists(t, filepath.Join(repoDir, ".git", "objects", "info", "alternates"))
+		require.Equal(t, "initial commit", headCommitMessage(t, repoDir))
+
+		xr := exec.NewExecer(repoDir)
+		_, err = xr.RunX(ctx, "git", "checkout", "-b", "fix")
+		requireNoErrorAndPrintStderr(t, err)
+
+		originURL, err := exec.TrimStdout(xr.RunX(ctx, "git", "remote", "get-url", "origin"))
+		requireNoErrorAndPrintStderr(t, err)
+		require.Equal(t, repo.SSHURL, originURL)
+	}
+}
+
+func TestCompleteCheckoutFromClone(t *testing.T) {
+	var checkedOut bool
+	wxr := mock.Execer{
+		RunXFn: func(ctx context.Context, command string, args ...string) (string, error) {
+			if mock.CallIs(t, command, args, "git", "lfs", "checkout", "assets", "README.md") {
+				checkedOut = true
+				return "", nil
+			}
+
+			return "", mock.ErrUnexpectedCall
+		},
+	}
+
+	// LFS objects are not pulled again
+	err := completeCheckoutFromClone(context.Background(), mock.Execer{}, wxr, RunOptions{LFS: LFSPullSubset, CloningSubset: []string{"assets", "README.md"}})
+	require.NoError(t, err)
+	require.True(t, checkedOut)
+}
+
+func overrideCloneRepository(t *testing.T, cloneFn func(context.Context, Repository, string, RunOptions) error) {
+	t.Helper()
+	oldFn := cloneRepositoryFunc
+	cloneRepositoryFunc = cloneFn
+	t.Cleanup(func() {
+		cloneRepositoryFunc = oldFn
+	})
+}
+
+func TestCloneRepositoryOrGetFromCacheConcurrently(t *testing.T) {
+	ctx := context.Background()
+	opts := RunOptions{CloneCacheKey: CloneCacheKeyFromString("key")}
+
+	// getFromCacheConcurrently calls cloneRepositoryOrGetFromCache from n goroutines and
+	// returns the errors and the HEAD commit message of the successful clones.
+	getFromCacheConcurrently := func(repo Repository, n int) ([]error, []string) {
+		var (
+			wg       sync.WaitGroup
+			mux      sync.Mutex
+			errs     []error
+			messages []string
+		)
+
+		for range n {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				repoDir, cleanup, err := cloneRepositoryOrGetFromCache(ctx, repo, opts)
+				if err == nil {
+					defer cleanup()
+
+					var msg string
+					msg, err = exec.TrimStdout(exec.NewExecer(repoDir).RunX(ctx, "git", "log", "-1", "--format=%s"))
+					if err == nil {
+						mux.Lock()
+						messages = append(messages, msg)
+						mux.Unlock()
+					}
+				}
+
+				if err != nil {
+					mux.Lock()
+					errs = append(errs, err)
+					mux.Unlock()
+				}
+			}()
+		}
+
+		wg.Wait()
+
+		return errs, messages
+	}
+
+	t.Run("clones once for concurrent callers", func(t *testing.T) {
+		repo := newTestRepository(t)
+
+		var clones atomic.Int32
+		overrideCloneRepository(t, func(ctx context.Context, repo Repository, dir string, opts RunOptions) error {
+			clones.Add(1)
+			// widens the window for other callers to find the cache half populated
+			time.Sleep(100 * time.Millisecond)
+			return cloneRepository(ctx, repo, dir, opts)
+		})
+
+		errs, messages := getFromCacheConcurrently(repo, 10)
+		require.Empty(t, errs)
+		require.Len(t, messages, 10)
+		for _, msg := range messages {
+			require.Equal(t, "initial commit", msg)
+		}
+		require.EqualValues(t, 1, clones.Load())
+	})
+
+	t.Run("waiting callers clone when the first clone fails", func(t *testing.T) {
+		repo := newTestRepository(t)
+
+		var clones atomic.Int32
+		overrideCloneRepository(t, func(ctx context.Context, repo Repository, dir string, opts RunOptions) error {
+			if clones.Add(1) == 1 {
+				time.Sleep(100 * time.Millisecond)
+				return errors.New("clone failed")
+			}
+
+			return cloneRepository(ctx, repo, dir, opts)
+		})
+
+		errs, messages := getFromCacheConcurrently(repo, 10)
+		require.Len(t, errs, 1)
+		require.EqualError(t, errs[0], "clone failed")
+		require.Len(t, messages, 9)
+		require.EqualValues(t, 2, clones.Load())
+	})
+
+	t.Run("stops waiting when the context is done", func(t *testing.T) {
+		repo := newTestRepository(t)
+
+		var (
+			cloneStarted = make(chan struct{})
+			releaseClone = make(chan struct{})
+		)
+		overrideCloneRepository(t, func(ctx context.Context, repo Repository, dir string, opts RunOptions) error {
+			close(cloneStarted)
+			<-releaseClone
+			return cloneRepository(ctx, repo, dir, opts)
+		})
+
+		firstErrC := make(chan error, 1)
+		go func() {
+			_, cleanup, err := cloneRepositoryOrGetFromCache(ctx, repo, opts)
+			if err == nil {
+				cleanup()
+			}
+			firstErrC <- err
+		}()
+
+		<-cloneStarted
+
+		waitCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+		defer cancel()
+
+		_, _, err := cloneRepositoryOrGetFromCache(waitCtx, repo, opts)
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+
+		close(releaseClone)
+		requireNoErrorAndPrintStderr(t, <-firstErrC)
+	})
+}
+
+func TestKeyedMutex(t *testing.T) {
+	ctx := context.Background()
+
+	var km keyedMutex
+
+	unlock, err := km.lock(ctx, "a")
+	require.NoError(t, err)
+
+	waitCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+
+	// the waiter giving up keeps the mutex held by the first caller
+	_, err = km.lock(waitCtx, "a")
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Len(t, km.locks, 1)
+
+	lockedC := make(chan func())
+	go func() {
+		unlock, err := km.lock(ctx, "a")
+		assert.NoError(t, err)
+		lockedC <- unlock
+	}()
+
+	unlock()
+	(<-lockedC)()
+
+	// the mutexes are deleted once no one holds or waits for them
+	require.Empty(t, km.locks)
+}
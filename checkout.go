@@ -0,0 +1,99 @@
+package iterator
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/jcchavezs/gh-iterator/exec"
+	"github.com/jcchavezs/gh-iterator/internal/log"
+)
+
+// SubmodulesMode represents how git submodules are checked out.
+type SubmodulesMode int
+
+const (
+	// SubmodulesNone does not check out the submodules.
+	SubmodulesNone SubmodulesMode = iota
+	// SubmodulesShallow checks out the top level submodules fetching only their latest commit.
+	SubmodulesShallow
+	// SubmodulesRecursive checks out the submodules and their nested submodules.
+	SubmodulesRecursive
+)
+
+// LFSMode represents how Git LFS objects are fetched.
+type LFSMode int
+
+const (
+	// LFSSkip does not fetch the LFS objects hence the LFS tracked files are left as pointers.
+	LFSSkip LFSMode = iota
+	// LFSPull fetches and checks out all the LFS objects.
+	LFSPull
+	// LFSPullSubset fetches and checks out only the LFS objects matching the CloningSubset.
+	LFSPullSubset
+)
+
+// newCloneExecer creates an execer to clone repositories. LFS objects are never downloaded on
+// checkout as they are pulled explicitly according to the LFS mode.
+func newCloneExecer(dir string, logger *slog.Logger, auth *Auth, host string) exec.Execer {
+	return withAuth(exec.NewExecerWithLogger(dir, logger).WithEnv("GIT_LFS_SKIP_SMUDGE", "1"), auth, host)
+}
+
+// completeCheckout checks out the submodules and LFS objects in the repository according to opts.
+func completeCheckout(ctx context.Context, xr exec.Execer, opts RunOptions) error {
+	logger := log.FromCtx(ctx)
+
+	var submoduleArgs []string
+	switch opts.Submodules {
+	case SubmodulesShallow:
+		logger.Debug("Checking out submodules", "mode", "shallow")
+		submoduleArgs = []string{"submodule", "update", "--init", "--depth", "1"}
+	case SubmodulesRecursive:
+		logger.Debug("Checking out submodules", "mode", "recursive")
+		submoduleArgs = []string{"submodule", "update", "--init", "--recursive"}
+	}
+
+	if len(submoduleArgs) > 0 {
+		err := retry(ctx, opts.Retry, "checking out submodules", func() error {
+			_, err := xr.RunX(ctx, "git", submoduleArgs...)
+			return err
+		})
+		if err != nil {
+			return withStderr("checking out submodules", err)
+		}
+	}
+
+	if opts.LFS == LFSSkip {
+		return nil
+	}
+
+	if _, err := xr.RunX(ctx, "git", "lfs", "version"); err != nil {
+		return fmt.Errorf("git-lfs is required to pull LFS objects: %w", err)
+	}
+
+	args := []string{"lfs", "pull"}
+	if opts.LFS == LFSPullSubset && len(opts.CloningSubset) > 0 {
+		args = append(args, "--include", strings.Join(opts.CloningSubset, ","))
+	}
+
+	logger.Debug("Pulling LFS objects")
+	err := retry(ctx, opts.Retry, "pulling LFS objects", func() error {
+		_, err := xr.RunX(ctx, "git", args...)
+		return err
+	})
+	if err != nil {
+		return withStderr("pulling LFS objects", err)
+	}
+
+	return nil
+}
+
+// withStderr wraps the error with the message and the stderr of the failed command if any.
+func withStderr(message string, err error) error {
+	if stderr, ok := exec.StderrNotEmpty(exec.GetStderr(err)); ok {
+		return fmt.Errorf("%s: %w: %s", message, err, strings.TrimSpace(stderr))
+	}
+
+	return fmt.Errorf("%s: %w", message, err)
+}
@@ -0,0 +1,125 @@
+package iterator
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/jcchavezs/gh-iterator/exec"
+	"github.com/jcchavezs/gh-iterator/exec/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// createBareRepoWithSubmodule creates a bare repository with a `main` branch including the
+// repository created by createBareRepo as a submodule in `lib`.
+func createBareRepoWithSubmodule(t *testing.T) string {
+	t.Helper()
+
+	// local submodules are disallowed by default since git 2.38.1
+	t.Setenv("GIT_CONFIG_COUNT", "1")
+	t.Setenv("GIT_CONFIG_KEY_0", "protocol.file.allow")
+	t.Setenv("GIT_CONFIG_VALUE_0", "always")
+
+	ctx := context.Background()
+	libRepo := createBareRepo(t)
+	dir := t.TempDir()
+	x := exec.NewExecer(dir).WithEnv(
+		"GIT_AUTHOR_NAME", "test", "GIT_AUTHOR_EMAIL", "test@github.com",
+		"GIT_COMMITTER_NAME", "test", "GIT_COMMITTER_EMAIL", "test@github.com",
+	)
+
+	for _, args := range [][]string{
+		{"init", "-b", "main", "src"},
+		{"-C", "src", "config", "commit.gpgsign", "false"},
+		{"-C", "src", "submodule", "add", libRepo, "lib"},
+		{"-C", "src", "commit", "-m", "adds lib"},
+		{"clone", "--bare", "src", "bare.git"},
+	} {
+		_, err := x.RunX(ctx, "git", args...)
+		requireNoErrorAndPrintStderr(t, err)
+	}
+
+	return filepath.Join(dir, "bare.git")
+}
+
+func TestCloneRepositorySubmodules(t *testing.T) {
+	ctx := context.Background()
+	repo := Repository{Name: "org/repo", SSHURL: createBareRepoWithSubmodule(t), DefaultBranchName: "main"}
+
+	t.Run("none", func(t *testing.T) {
+		dir := t.TempDir()
+		err := cloneRepository(ctx, repo, dir, RunOptions{})
+		requireNoErrorAndPrintStderr(t, err)
+		require.NoFileExists(t, filepath.Join(dir, "lib", "README.md"))
+	})
+
+	t.Run("shallow", func(t *testing.T) {
+		dir := t.TempDir()
+		err := cloneRepository(ctx, repo, dir, RunOptions{Submodules: SubmodulesShallow})
+		requireNoErrorAndPrintStderr(t, err)
+		require.FileExists(t, filepath.Join(dir, "lib", "README.md"))
+	})
+
+	t.Run("recursive", func(t *testing.T) {
+		dir := t.TempDir()
+		err := cloneRepository(ctx, repo, dir, RunOptions{Submodules: SubmodulesRecursive})
+		requireNoErrorAndPrintStderr(t, err)
+		require.FileExists(t, filepath.Join(dir, "lib", "README.md"))
+	})
+}
+
+func TestCompleteCheckout(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("submodules failure includes stderr", func(t *testing.T) {
+		xr := mock.Execer{
+			RunXFn: func(ctx context.Context, command string, args ...string) (string, error) {
+				return "", exec.NewExecErr("git submodule update: exit code 1", "fatal: repository not found\n", 1)
+			},
+		}
+
+		err := completeCheckout(ctx, xr, RunOptions{Submodules: SubmodulesRecursive})
+		require.EqualError(t, err, "checking out submodules: git submodule update: exit code 1: fatal: repository not found")
+	})
+
+	t.Run("LFS pull subset", func(t *testing.T) {
+		var pulled bool
+		xr := mock.Execer{
+			RunXFn: func(ctx context.Context, command string, args ...string) (string, error) {
+				if mock.CallIs(t, command, args, "git", "lfs", "version") {
+					return "git-lfs/3.4.0", nil
+				}
+
+				if mock.CallIs(t, command, args, "git", "lfs", "pull", "--include", "assets,README.md") {
+					pulled = true
+					return "", nil
+				}
+
+				return "", mock.ErrUnexpectedCall
+			},
+		}
+
+		err := completeCheckout(ctx, xr, RunOptions{LFS: LFSPullSubset, CloningSubset: []string{"assets", "README.md"}})
+		require.NoError(t, err)
+		require.True(t, pulled)
+	})
+
+	t.Run("LFS not installed", func(t *testing.T) {
+		lfsErr := errors.New("git lfs version: exit code 1")
+		xr := mock.Execer{
+			RunXFn: func(ctx context.Context, command string, args ...string) (string, error) {
+				return "", lfsErr
+			},
+		}
+
+		err := completeCheckout(ctx, xr, RunOptions{LFS: LFSPull})
+		require.ErrorIs(t, err, lfsErr)
+		require.ErrorContains(t, err, "git-lfs is required")
+	})
+
+	t.Run("nothing to complete", func(t *testing.T) {
+		err := completeCheckout(ctx, mock.Execer{}, RunOptions{})
+		require.NoError(t, err)
+	})
+}
@@ -0,0 +1,123 @@
+package iterator
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/jcchavezs/gh-iterator/exec"
+)
+
+// CollectProcessor is a processor that returns a value for the repository.
+type CollectProcessor[T any] func(ctx context.Context, repository string, isEmpty bool, exec exec.Execer) (T, error)
+
+var (
+	errCollectBranches        = errors.New("RunOptions.Branches is not supported by Collect, use CollectBranches")
+	errCollectBranchesMissing = errors.New("RunOptions.Branches is required by CollectBranches")
+)
+
+// collector gathers the values returned for every key concurrently.
+type collector[K comparable, T any] struct {
+	mux    sync.Mutex
+	values map[K]T
+}
+
+func (c *collector[K, T]) add(key K, v T) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	if c.values == nil {
+		c.values = map[K]T{}
+	}
+
+	c.values[key] = v
+}
+
+func (c *collector[K, T]) result() map[K]T {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	if c.values == nil {
+		return map[K]T{}
+	}
+
+	return c.values
+}
+
+// Collect runs the processor for all repositories in an organization like RunForOrganization and
+// returns the values keyed by repository name. The values collected so far are returned along
+// with the error if the run fails. It fails when Options.Branches is set as every repository
+// would have many values, use CollectBranches instead.
+func Collect[T any](ctx context.Context, orgName string, searchOpts SearchOptions, processor CollectProcessor[T], opts RunOptions) (map[string]T, Result, error) {
+	if len(opts.Branches) > 0 {
+		return map[string]T{}, Result{}, errCollectBranches
+	}
+
+	var c collector[string, T]
+
+	res, err := RunForOrganization(ctx, orgName, searchOpts, func(ctx context.Context, repository string, isEmpty bool, exec exec.Execer) error {
+		v, err := processor(ctx, repository, isEmpty, exec)
+		if err != nil {
+			return err
+		}
+
+		c.add(repository, v)
+		return nil
+	}, opts)
+
+	return c.result(), res, err
+}
+
+// CollectBranches runs the processor for the branches matching Options.Branches in all
+// repositories in an organization like RunForOrganization and returns the values keyed by
+// repository name and then by branch. The values collected so far are returned along with the
+// error if the run fails.
+func CollectBranches[T any](ctx context.Context, orgName string, searchOpts SearchOptions, processor CollectProcessor[T], opts RunOptions) (map[string]map[string]T, Result, error) {
+	if len(opts.Branches) == 0 {
+		return map[string]map[string]T{}, Result{}, errCollectBranchesMissing
+	}
+
+	var c collector[[2]string, T]
+
+	res, err := RunForOrganization(ctx, orgName, searchOpts, func(ctx context.Context, repository string, isEmpty bool, exec exec.Execer) error {
+		v, err := processor(ctx, repository, isEmpty, exec)
+		if err != nil {
+			return err
+		}
+
+		// empty repositories have no branches hence they are keyed by the empty branch
+		branch, _ := BranchFromContext(ctx)
+		c.add([2]string{repository, branch}, v)
+		return nil
+	}, opts)
+
+	values := map[string]map[string]T{}
+	for key, v := range c.result() {
+		if values[key[0]] == nil {
+			values[key[0]] = map[string]T{}
+		}
+
+		values[key[0]][key[1]] = v
+	}
+
+	return values, res, err
+}
+
+// CollectList runs the callback for all repositories in an organization like ListForOrganization
+// and returns the values keyed by repository name. The values collected so far are returned along
+// with the error if the run fails.
+func CollectList[T any](ctx context.Context, orgName string, searchOpts SearchOptions, callback func(ctx context.Context, xr exec.Execer, repository string) (T, error), opts ListOptions) (map[string]T, Result, error) {
+	var c collector[string, T]
+
+	res, err := ListForOrganization(ctx, orgName, searchOpts, func(ctx context.Context, xr exec.Execer, repository string) error {
+		v, err := callback(ctx, xr, repository)
+		if err != nil {
+			return err
+		}
+
+		c.add(repository, v)
+		return nil
+	}, opts)
+
+	return c.result(), res, err
+}
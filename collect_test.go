@@ -0,0 +1,107 @@
+package iterator
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jcchavezs/gh-iterator/exec"
+	"github.com/jcchavezs/gh-iterator/github"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeClient is a github.Client returning fixed repository pages after an optional delay.
+type fakeClient struct {
+	github.Client
+	repoPages [][]Repository
+	delay     time.Duration
+}
+
+func (c fakeClient) ListOrganizationRepositories(context.Context, string, github.ListRepositoriesOptions) ([][]Repository, error) {
+	time.Sleep(c.delay)
+	return c.repoPages, nil
+}
+
+func (c fakeClient) GetRepository(_ context.Context, name string) (Repository, error) {
+	for _, repoPage := range c.repoPages {
+		for _, repo := range repoPage {
+			if repo.Name == name {
+				return repo, nil
+			}
+		}
+	}
+
+	return Repository{}, errors.New("not found")
+}
+
+func TestCollect(t *testing.T) {
+	ctx := context.Background()
+	repo1, repo2 := newTestRepository(t), newTestRepository(t)
+	repo1.Language = "Go"
+
+	opts := RunOptions{
+		Client:                fakeClient{repoPages: [][]Repository{{repo1, repo2}}},
+		SkipCloneabilityCheck: true,
+	}
+
+	t.Run("success", func(t *testing.T) {
+		values, res, err := Collect(ctx, "my-org", SearchOptions{}, func(ctx context.Context, repository string, isEmpty bool, xr exec.Execer) (string, error) {
+			return exec.TrimStdout(xr.RunX(ctx, "git", "log", "-1", "--format=%s"))
+		}, opts)
+		requireNoErrorAndPrintStderr(t, err)
+		require.Equal(t, 2, res.Processed)
+		require.Equal(t, map[string]string{repo1.Name: "initial commit", repo2.Name: "initial commit"}, values)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		values, _, err := Collect(ctx, "my-org", SearchOptions{}, func(ctx context.Context, repository string, isEmpty bool, xr exec.Execer) (int, error) {
+			if repository == repo2.Name {
+				return 0, errors.New("boom")
+			}
+
+			return 1, nil
+		}, RunOptions{
+			Client:                opts.Client,
+			SkipCloneabilityCheck: true,
+			NumberOfWorkers:       1,
+		})
+		require.ErrorContains(t, err, "boom")
+		require.Equal(t, map[string]int{repo1.Name: 1}, values)
+	})
+}
+
+func TestCollectBranches(t *testing.T) {
+	ctx := context.Background()
+	repo1, repo2 := newTestRepository(t), newTestRepository(t)
+
+	opts := RunOptions{
+		Client:                fakeClient{repoPages: [][]Repository{{repo1, repo2}}},
+		SkipCloneabilityCheck: true,
+		Branches:              []string{"main", "release-*"},
+	}
+
+	headCommit := func(ctx context.Context, repository string, isEmpty bool, xr exec.Execer) (string, error) {
+		return exec.TrimStdout(xr.RunX(ctx, "git", "log", "-1", "--format=%s"))
+	}
+
+	t.Run("success", func(t *testing.T) {
+		values, res, err := CollectBranches(ctx, "my-org", SearchOptions{}, headCommit, opts)
+		requireNoErrorAndPrintStderr(t, err)
+		require.Equal(t, 2, res.Processed)
+
+		branches := map[string]string{"main": "initial commit", "release-1": "release commit"}
+		require.Equal(t, map[string]map[string]string{repo1.Name: branches, repo2.Name: branches}, values)
+	})
+
+	t.Run("Collect rejects branches", func(t *testing.T) {
+		values, _, err := Collect(ctx, "my-org", SearchOptions{}, headCommit, opts)
+		require.ErrorIs(t, err, errCollectBranches)
+		require.Empty(t, values)
+	})
+
+	t.Run("branches are required", func(t *testing.T) {
+		_, _, err := CollectBranches(ctx, "my-org", SearchOptions{}, headCommit, RunOptions{Client: opts.Client})
+		require.ErrorIs(t, err, errCollectBranchesMissing)
+	})
+}
@@ -6,7 +6,9 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"maps"
 	"os"
+	"slices"
 	"strings"
 
 	iterator "github.com/jcchavezs/gh-iterator"
@@ -29,34 +31,40 @@ func main() {
 		Level: slog.LevelInfo,
 	}))
 
-	res, err := iterator.RunForOrganization(context.Background(), org, iterator.SearchOptions{
+	reports, res, err := iterator.Collect(context.Background(), org, iterator.SearchOptions{
 		Languages:     []string{"Go"},
 		Source:        iterator.OnlyNonForks,
 		PerPage:       20,
 		SizeCondition: iterator.NotEmpty,
-	}, func(ctx context.Context, repository string, isEmpty bool, exec exec.Execer) error {
+	}, func(ctx context.Context, repository string, isEmpty bool, exec exec.Execer) (string, error) {
 		fmt.Printf("Processing %s/%s\n", org, repository)
 
 		res, err := exec.Run(ctx, "govulncheck", "./...")
 		if err != nil {
-			return fmt.Errorf("checking for vulnerabilities: %w", err)
+			return "", fmt.Errorf("checking for vulnerabilities: %w", err)
 		}
 
 		if res.ExitCode == 0 {
 			_, _ = fmt.Printf("No vulnerabilities found for %s/%s\n", org, repository)
-		} else if len(res.TrimStdout()) > 0 {
-			_, _ = fmt.Fprintf(f, "%s\n%s\n", repository, strings.Repeat("-", len(repository)))
-			_, _ = f.WriteString(res.Stdout)
-			_, _ = f.WriteString("\n")
+			return "", nil
 		}
 
-		return nil
+		return res.TrimStdout(), nil
 	}, iterator.Options{LogHandler: logger.Handler()})
 	if err != nil {
 		fmt.Printf("ERROR: %v\n", err)
 		os.Exit(1)
 	}
 
+	repositories := slices.Sorted(maps.Keys(reports))
+	for _, repository := range repositories {
+		if report := reports[repository]; len(report) > 0 {
+			_, _ = fmt.Fprintf(f, "%s\n%s\n", repository, strings.Repeat("-", len(repository)))
+			_, _ = f.WriteString(report)
+			_, _ = f.WriteString("\n\n")
+		}
+	}
+
 	if res.Found == 0 {
 		fmt.Printf("No Go repositories found %s.\n", org)
 	}
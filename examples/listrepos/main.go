@@ -6,44 +6,30 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
-	"sync"
 
 	iterator "github.com/jcchavezs/gh-iterator"
 	iteratorexec "github.com/jcchavezs/gh-iterator/exec"
 )
 
 func main() {
-	var (
-		boardMux sync.Mutex
-		onboard  = 0
-		offboard = 0
-	)
-
-	res, err := iterator.ListForOrganization(
+	onboarded, res, err := iterator.CollectList(
 		context.Background(),
 		"jcchavezs",
 		iterator.SearchOptions{
 			Page: iterator.AllPages,
 		},
-		func(ctx context.Context, xr iteratorexec.Execer, repo string) error {
+		// nil means the manifest could not be checked
+		func(ctx context.Context, xr iteratorexec.Execer, repo string) (*bool, error) {
 			path := ".github/dependabot.yml"
 
 			res, err := xr.Run(ctx, "gh", "api", fmt.Sprintf("/repos/%s/contents/%s", repo, path))
 			if err != nil {
 				xr.Log(ctx, slog.LevelError, "Failed to read dependabot manifest")
-				return nil
+				return nil, nil
 			}
 
-			boardMux.Lock()
-			defer boardMux.Unlock()
-
-			if res.ExitCode == 0 {
-				onboard++
-			} else {
-				offboard++
-			}
-
-			return nil
+			hasManifest := res.ExitCode == 0
+			return &hasManifest, nil
 		}, iterator.ListOptions{
 			NumberOfWorkers: 5,
 		},
@@ -53,6 +39,19 @@ func main() {
 		return
 	}
 
+	var onboard, offboard int
+	for _, hasManifest := range onboarded {
+		if hasManifest == nil {
+			continue
+		}
+
+		if *hasManifest {
+			onboard++
+		} else {
+			offboard++
+		}
+	}
+
 	fmt.Printf("Total repositories: %d\n", res.Processed)
 	fmt.Printf("Onboarded repositories: %d\n", onboard)
 	fmt.Printf("Offboarded repositories: %d\n", offboard)
@@ -0,0 +1,81 @@
+package exec
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	osexec "os/exec"
+	"strings"
+	"time"
+)
+
+// waitDelay is the time to wait for the output pipes to be closed once the command exits or is
+// killed. Processes that escaped the process group could otherwise keep them open forever.
+const waitDelay = 5 * time.Second
+
+// runCommand runs the command in dir with env overriding the current environment. When the
+// context can be cancelled and it is done, the whole process group is killed, not only the
+// command, hence processes spawned by it e.g. a test binary run by `go test` do not outlive it.
+func runCommand(ctx context.Context, dir string, env []string, stdin io.Reader, command string, args ...string) (Result, error) {
+	// don't try to run if the context is already done
+	if err := ctx.Err(); err != nil {
+		return Result{ExitCode: -1, Cancelled: errors.Is(err, context.Canceled)}, err
+	}
+
+	cmd := osexec.CommandContext(ctx, command, args...)
+	cmd.Dir = dir
+	cmd.Env = mergeEnv(env)
+	if stdin != nil {
+		cmd.Stdin = stdin
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	cmd.WaitDelay = waitDelay
+	killProcessGroupOnCancel(ctx, cmd)
+
+	if err := cmd.Start(); err != nil {
+		return Result{}, err
+	}
+
+	exitCode := 0
+	if err := cmd.Wait(); err != nil {
+		var exitErr *osexec.ExitError
+		if errors.As(err, &exitErr) {
+			exitCode = exitErr.ExitCode()
+		}
+	}
+
+	return Result{
+		Stdout:    stdout.String(),
+		Stderr:    stderr.String(),
+		ExitCode:  exitCode,
+		Cancelled: errors.Is(ctx.Err(), context.Canceled),
+	}, ctx.Err()
+}
+
+// mergeEnv returns the current environment with the env overrides, or nil to inherit it as is.
+func mergeEnv(env []string) []string {
+	if len(env) == 0 {
+		return nil
+	}
+
+	overrides := map[string]bool{}
+	merged := make([]string, 0, len(env))
+	for _, kv := range env {
+		key, _, _ := strings.Cut(kv, "=")
+		overrides[key] = true
+		merged = append(merged, kv)
+	}
+
+	for _, kv := range os.Environ() {
+		key, _, _ := strings.Cut(kv, "=")
+		if !overrides[key] {
+			merged = append(merged, kv)
+		}
+	}
+
+	return merged
+}
@@ -0,0 +1,12 @@
+//go:build !unix
+
+package exec
+
+import (
+	"context"
+	osexec "os/exec"
+)
+
+// killProcessGroupOnCancel keeps the default behaviour of killing only the command as process
+// groups are not available. WaitDelay still bounds the wait for its children.
+func killProcessGroupOnCancel(context.Context, *osexec.Cmd) {}
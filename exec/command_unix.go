@@ -0,0 +1,24 @@
+//go:build unix
+
+package exec
+
+import (
+	"context"
+	osexec "os/exec"
+	"syscall"
+)
+
+// killProcessGroupOnCancel starts the command in its own process group and kills the whole
+// group when the context is done. Commands run without cancellation stay in the process group
+// of the caller so signals sent to it from the terminal e.g. Ctrl-C still reach them. Callers
+// handling those signals are expected to cancel the context e.g. with signal.NotifyContext.
+func killProcessGroupOnCancel(ctx context.Context, cmd *osexec.Cmd) {
+	if ctx.Done() == nil {
+		return
+	}
+
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+}
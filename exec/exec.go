@@ -9,7 +9,6 @@ import (
 	"path/filepath"
 	"strings"
 
-	"github.com/alexellis/go-execute/v2"
 	"github.com/jcchavezs/gh-iterator/internal/log"
 	"github.com/spf13/afero"
 )
@@ -148,23 +147,15 @@ func (e execer) RunX(ctx context.Context, command string, args ...string) (strin
 
 // RunWithStdin executes a command with the repository's folder as working dir accepting a stdin
 func (e execer) RunWithStdin(ctx context.Context, stdin io.Reader, command string, args ...string) (Result, error) {
-	task := execute.ExecTask{
-		Command: command,
-		Args:    args,
-		Cwd:     e.dir,
-		Stdin:   stdin,
-		Env:     e.env,
-	}
-
 	cmdS := cmdString(command, args...)
 	e.logger.Debug("Executing command", "command", cmdS)
 
-	execRes, err := task.Execute(ctx)
+	res, err := runCommand(ctx, e.dir, e.env, stdin, command, args...)
 	if err != nil {
 		return Result{}, fmt.Errorf("%s: %w", cmdS, err)
 	}
 
-	return Result(execRes), nil
+	return res, nil
 }
 
 // RunWithStdin executes a command with the repository's folder as working dir accepting a stdin and returning the stdout
@@ -0,0 +1,42 @@
+//go:build unix
+
+package exec
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunKillsProcessGroupOnCancel(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+
+	// sleep runs as a grandchild holding the stdout pipe open after sh is killed
+	startedAt := time.Now()
+	_, err := NewExecer(t.TempDir()).Run(ctx, "sh", "-c", "sleep 5; echo done")
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Less(t, time.Since(startedAt), 3*time.Second)
+}
+
+func TestRunProcessGroup(t *testing.T) {
+	pgid := func(ctx context.Context) string {
+		out, err := TrimStdout(NewExecer(t.TempDir()).RunX(ctx, "sh", "-c", "ps -o pgid= -p $$"))
+		require.NoError(t, err)
+		return strings.TrimSpace(out)
+	}
+
+	callerPgid := strconv.Itoa(syscall.Getpgrp())
+
+	// without cancellation the command stays in the caller group and gets the terminal signals
+	require.Equal(t, callerPgid, pgid(context.Background()))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NotEqual(t, callerPgid, pgid(ctx))
+}
@@ -0,0 +1,104 @@
+package iterator
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrorPolicy decides whether the run continues when processing a repository fails.
+type ErrorPolicy int
+
+const (
+	// FailFast stops scheduling repositories on the first failure and returns its error.
+	FailFast ErrorPolicy = iota
+	// ContinueOnError processes all the repositories and returns the failures joined, unless the
+	// circuit breaker configured with Options.MaxFailures or Options.FailureRate trips.
+	ContinueOnError
+)
+
+// callRecovering calls fn converting a panic into a PanicError with the stack trace. The deferred
+// cleanups of fn e.g. removing the clone still run as the panic unwinds.
+func callRecovering(fn func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = newPanicError(r)
+		}
+	}()
+
+	return fn()
+}
+
+// ErrCircuitBreakerTripped is returned when the run is aborted because of too many failures as
+// configured in Options.MaxFailures and Options.FailureRate.
+var ErrCircuitBreakerTripped = errors.New("circuit breaker tripped")
+
+// FailureRateOptions aborts the run when the rate of failed repositories within the last
+// repositories processed reaches the threshold.
+type FailureRateOptions struct {
+	// Window is the number of the last repositories processed to compute the rate on. The rate is
+	// not evaluated until that many repositories are processed.
+	Window int
+	// Threshold is the rate of failures between 0 and 1 e.g. 0.5 to abort when half of the
+	// repositories in the window failed.
+	Threshold float64
+}
+
+// circuitBreaker aborts the run on consecutive failures or a high failure rate. Skipped
+// repositories count neither as successes nor as failures. It is not safe for concurrent use.
+type circuitBreaker struct {
+	maxFailures int
+	rate        *FailureRateOptions
+
+	consecutive int
+	// window is a ring buffer with the last results, true meaning failed.
+	window  []bool
+	next    int
+	samples int
+}
+
+func newCircuitBreaker(maxFailures int, rate *FailureRateOptions) *circuitBreaker {
+	cb := &circuitBreaker{maxFailures: maxFailures}
+	if rate != nil && rate.Window > 0 && rate.Threshold > 0 {
+		cb.rate = rate
+		cb.window = make([]bool, rate.Window)
+	}
+
+	return cb
+}
+
+// record records the result of a repository and returns an error if the breaker trips.
+func (cb *circuitBreaker) record(failed bool) error {
+	if failed {
+		cb.consecutive++
+	} else {
+		cb.consecutive = 0
+	}
+
+	if cb.maxFailures > 0 && cb.consecutive >= cb.maxFailures {
+		return fmt.Errorf("%w: aborted after %d consecutive failures", ErrCircuitBreakerTripped, cb.consecutive)
+	}
+
+	if cb.rate == nil {
+		return nil
+	}
+
+	cb.window[cb.next] = failed
+	cb.next = (cb.next + 1) % len(cb.window)
+	cb.samples = min(cb.samples+1, len(cb.window))
+	if cb.samples < len(cb.window) {
+		return nil
+	}
+
+	var failures int
+	for _, f := range cb.window {
+		if f {
+			failures++
+		}
+	}
+
+	if rate := float64(failures) / float64(len(cb.window)); rate >= cb.rate.Threshold {
+		return fmt.Errorf("%w: aborted after %d failures in the last %d repositories", ErrCircuitBreakerTripped, failures, len(cb.window))
+	}
+
+	return nil
+}
@@ -0,0 +1,117 @@
+package iterator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+
+	"github.com/jcchavezs/gh-iterator/exec"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunForReposConcurrentlyPanics(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("clone is cleaned up", func(t *testing.T) {
+		repo := newTestRepository(t)
+
+		var repoDir string
+		res, err := runForReposConcurrently(ctx, [][]Repository{{repo}}, 1, processAll, processRepository,
+			func(ctx context.Context, repository string, isEmpty bool, xr exec.Execer) error {
+				info, _ := RepositoryFromContext(ctx)
+				repoDir = info.Dir
+				panic("boom")
+			}, RunOptions{})
+
+		var panicErr *PanicError
+		require.ErrorAs(t, err, &panicErr)
+		require.Equal(t, "boom", panicErr.Value)
+		require.Contains(t, string(panicErr.Stack), "TestRunForReposConcurrentlyPanics")
+		require.EqualError(t, err, fmt.Sprintf("processing %q: panic: boom", repo.Name))
+
+		require.NotEmpty(t, repoDir)
+		require.NoDirExists(t, repoDir)
+
+		require.Len(t, res.Outcomes, 1)
+		require.Equal(t, OutcomeFailed, res.Outcomes[0].Status)
+	})
+
+	t.Run("continue on error", func(t *testing.T) {
+		repoPages := [][]Repository{{{Name: "repo1"}, {Name: "repo2"}, {Name: "repo3"}}}
+
+		res, err := runForReposConcurrently(ctx, repoPages, 2, processAll, func(ctx context.Context, repo Repository, processor Processor, opts RunOptions) error {
+			switch repo.Name {
+			case "repo1":
+				panic("boom")
+			case "repo2":
+				return errors.New("failed")
+			}
+			return nil
+		}, nil, RunOptions{ErrorPolicy: ContinueOnError})
+
+		var panicErr *PanicError
+		require.ErrorAs(t, err, &panicErr)
+		require.ErrorContains(t, err, `processing "repo2": failed`)
+
+		statuses := map[string]OutcomeStatus{}
+		for _, o := range res.Outcomes {
+			statuses[o.Repository] = o.Status
+		}
+		require.Equal(t, map[string]OutcomeStatus{"repo1": OutcomeFailed, "repo2": OutcomeFailed, "repo3": OutcomeProcessed}, statuses)
+	})
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	t.Run("consecutive failures", func(t *testing.T) {
+		cb := newCircuitBreaker(3, nil)
+		require.NoError(t, cb.record(true))
+		require.NoError(t, cb.record(true))
+		require.NoError(t, cb.record(false))
+		require.NoError(t, cb.record(true))
+		require.NoError(t, cb.record(true))
+
+		err := cb.record(true)
+		require.ErrorIs(t, err, ErrCircuitBreakerTripped)
+		require.ErrorContains(t, err, "aborted after 3 consecutive failures")
+	})
+
+	t.Run("failure rate", func(t *testing.T) {
+		cb := newCircuitBreaker(0, &FailureRateOptions{Window: 4, Threshold: 0.75})
+		for _, failed := range []bool{true, false, true, false, true} {
+			require.NoError(t, cb.record(failed))
+		}
+
+		err := cb.record(true)
+		require.ErrorIs(t, err, ErrCircuitBreakerTripped)
+		require.ErrorContains(t, err, "aborted after 3 failures in the last 4 repositories")
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		cb := newCircuitBreaker(0, nil)
+		for range 10 {
+			require.NoError(t, cb.record(true))
+		}
+	})
+}
+
+func TestRunForReposConcurrentlyCircuitBreaker(t *testing.T) {
+	var repos []Repository
+	for i := range 10 {
+		repos = append(repos, Repository{Name: fmt.Sprintf("repo%d", i)})
+	}
+
+	var calls atomic.Int32
+	res, err := runForReposConcurrently(context.Background(), [][]Repository{repos}, 1, processAll, func(ctx context.Context, repo Repository, processor Processor, opts RunOptions) error {
+		calls.Add(1)
+		return errors.New("bad credentials")
+	}, nil, RunOptions{ErrorPolicy: ContinueOnError, MaxFailures: 3})
+	require.ErrorIs(t, err, ErrCircuitBreakerTripped)
+	require.ErrorContains(t, err, "aborted after 3 consecutive failures")
+	require.ErrorContains(t, err, `processing "repo0": bad credentials`)
+
+	// the repositories already queued for the worker are processed
+	require.Less(t, int(calls.Load()), len(repos))
+	require.Len(t, res.Outcomes, int(calls.Load()))
+}
@@ -0,0 +1,73 @@
+package iterator
+
+import (
+	"cmp"
+	"context"
+	"slices"
+)
+
+// Severity is the severity of a finding. The values match the SARIF result levels.
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+	SeverityNote    Severity = "note"
+)
+
+// Finding is an issue found by a processor in a repository e.g. a vulnerability or a
+// policy violation.
+type Finding struct {
+	// Repository is the name of the repository, set when the finding is reported.
+	Repository string
+	// RuleID identifies the check that produced the finding e.g. GO-2024-2687.
+	RuleID string
+	// Severity is the severity of the finding, by default SeverityWarning.
+	Severity Severity
+	// File is the path of the file relative to the repository root if any.
+	File string
+	// Line is the 1-based line in the file if any.
+	Line int
+	// Message describes the finding.
+	Message string
+}
+
+// ReportFinding reports a finding for the repository being processed. Findings are included in
+// the outcome of the repository and aggregated across the run by Result.Findings, or passed to
+// Hooks.OnProgress by RunForRepository. It does nothing if the context does not belong to a
+// repository being processed.
+func ReportFinding(ctx context.Context, f Finding) {
+	s := repoStatsFromContext(ctx)
+	if s == nil {
+		return
+	}
+
+	if f.Severity == "" {
+		f.Severity = SeverityWarning
+	}
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	s.findings = append(s.findings, f)
+}
+
+// Findings returns the findings reported for all repositories sorted by repository, file,
+// line and rule.
+func (r Result) Findings() []Finding {
+	var findings []Finding
+	for _, o := range r.Outcomes {
+		findings = append(findings, o.Findings...)
+	}
+
+	slices.SortStableFunc(findings, func(a, b Finding) int {
+		return cmp.Or(
+			cmp.Compare(a.Repository, b.Repository),
+			cmp.Compare(a.File, b.File),
+			cmp.Compare(a.Line, b.Line),
+			cmp.Compare(a.RuleID, b.RuleID),
+		)
+	})
+
+	return findings
+}
@@ -0,0 +1,233 @@
+package github
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultAPIBaseURL = "https://api.github.com"
+	apiVersion        = "2022-11-28"
+
+	// appJWTLifetime is the lifetime of the JWTs authenticating as the app, GitHub allows up to 10 minutes.
+	appJWTLifetime = 9 * time.Minute
+	// appTokenRefreshMargin is how long before the expiry an installation token is refreshed.
+	appTokenRefreshMargin = 5 * time.Minute
+)
+
+// AppOptions contains the options to authenticate as a GitHub App installation.
+type AppOptions struct {
+	// AppID is the ID of the GitHub App.
+	AppID int64
+	// PrivateKey is the PEM encoded private key of the GitHub App.
+	PrivateKey []byte
+	// InstallationID is the ID of the app installation to get tokens for.
+	InstallationID int64
+	// Organization is the organization where the app is installed. It is used to look up the
+	// installation when InstallationID is not set.
+	Organization string
+	// BaseURL is the base URL of the GitHub API, by default https://api.github.com. Use APIBaseURL
+	// to target a GitHub Enterprise Server host.
+	BaseURL string
+	// HTTPClient is the client to call the GitHub API, by default http.DefaultClient.
+	HTTPClient *http.Client
+}
+
+// AppTokenSource provides installation tokens for a GitHub App. Tokens are cached and
+// refreshed before they expire.
+type AppTokenSource struct {
+	opts       AppOptions
+	privateKey *rsa.PrivateKey
+	now        func() time.Time
+
+	mux            sync.Mutex
+	installationID int64
+	token          string
+	expiresAt      time.Time
+}
+
+// NewAppTokenSource creates a token source for the GitHub App installation.
+func NewAppTokenSource(opts AppOptions) (*AppTokenSource, error) {
+	if opts.AppID == 0 {
+		return nil, errors.New("missing app ID")
+	}
+
+	if opts.InstallationID == 0 && opts.Organization == "" {
+		return nil, errors.New("missing installation ID or organization")
+	}
+
+	key, err := parseRSAPrivateKey(opts.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("parsing private key: %w", err)
+	}
+
+	if opts.BaseURL == "" {
+		opts.BaseURL = defaultAPIBaseURL
+	}
+	opts.BaseURL = strings.TrimSuffix(opts.BaseURL, "/")
+
+	if opts.HTTPClient == nil {
+		opts.HTTPClient = http.DefaultClient
+	}
+
+	return &AppTokenSource{
+		opts:           opts,
+		privateKey:     key,
+		now:            time.Now,
+		installationID: opts.InstallationID,
+	}, nil
+}
+
+var _ IdentifiedTokenSource = (*AppTokenSource)(nil)
+
+// Identity returns the app and the installation, or the organization when the installation is
+// looked up, the tokens authenticate as.
+func (s *AppTokenSource) Identity() string {
+	if s.opts.InstallationID != 0 {
+		return fmt.Sprintf("app:%d installation:%d", s.opts.AppID, s.opts.InstallationID)
+	}
+
+	return fmt.Sprintf("app:%d org:%s", s.opts.AppID, s.opts.Organization)
+}
+
+// Token returns a valid installation token, minting a new one if the current one is about to expire.
+func (s *AppTokenSource) Token(ctx context.Context) (string, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if s.token != "" && s.now().Add(appTokenRefreshMargin).Before(s.expiresAt) {
+		return s.token, nil
+	}
+
+	jwt, err := s.signJWT()
+	if err != nil {
+		return "", fmt.Errorf("signing JWT: %w", err)
+	}
+
+	if s.installationID == 0 {
+		var installation struct {
+			ID int64 `json:"id"`
+		}
+
+		if err := s.call(ctx, http.MethodGet, fmt.Sprintf("/orgs/%s/installation", s.opts.Organization), jwt, &installation); err != nil {
+			return "", fmt.Errorf("getting installation for organization %q: %w", s.opts.Organization, err)
+		}
+
+		s.installationID = installation.ID
+	}
+
+	var accessToken struct {
+		Token     string    `json:"token"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+
+	if err := s.call(ctx, http.MethodPost, fmt.Sprintf("/app/installations/%d/access_tokens", s.installationID), jwt, &accessToken); err != nil {
+		return "", fmt.Errorf("creating installation token: %w", err)
+	}
+
+	s.token, s.expiresAt = accessToken.Token, accessToken.ExpiresAt
+
+	return s.token, nil
+}
+
+// call calls the GitHub API authenticating as the app and decodes the response into res.
+func (s *AppTokenSource) call(ctx context.Context, method, path, jwt string, res any) error {
+	req, err := http.NewRequestWithContext(ctx, method, s.opts.BaseURL+path, nil)
+	if err != nil {
+		return fmt.Errorf("creating request: %w", err)
+	}
+
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("Authorization", "Bearer "+jwt)
+	req.Header.Set("X-GitHub-Api-Version", apiVersion)
+
+	httpRes, err := s.opts.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer httpRes.Body.Close() //nolint:errcheck
+
+	if httpRes.StatusCode >= http.StatusMultipleChoices {
+		payload, _ := io.ReadAll(httpRes.Body)
+		return newAPIError(httpRes.StatusCode, payload)
+	}
+
+	if err := json.NewDecoder(httpRes.Body).Decode(res); err != nil {
+		return fmt.Errorf("unmarshaling response: %w", err)
+	}
+
+	return nil
+}
+
+// signJWT creates a JWT to authenticate as the app.
+func (s *AppTokenSource) signJWT() (string, error) {
+	now := s.now()
+
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+
+	claims, err := json.Marshal(map[string]any{
+		// issued in the past to allow for clock drift
+		"iat": now.Add(-time.Minute).Unix(),
+		"exp": now.Add(appJWTLifetime).Unix(),
+		"iss": strconv.FormatInt(s.opts.AppID, 10),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	var unsigned bytes.Buffer
+	unsigned.WriteString(base64.RawURLEncoding.EncodeToString(header))
+	unsigned.WriteString(".")
+	unsigned.WriteString(base64.RawURLEncoding.EncodeToString(claims))
+
+	digest := sha256.Sum256(unsigned.Bytes())
+	signature, err := rsa.SignPKCS1v15(rand.Reader, s.privateKey, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+
+	return unsigned.String() + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// parseRSAPrivateKey parses a PEM encoded RSA private key in PKCS#1 or PKCS#8 format.
+func parseRSAPrivateKey(pemKey []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(pemKey)
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("private key is not an RSA key")
+	}
+
+	return rsaKey, nil
+}
@@ -0,0 +1,164 @@
+package github
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// verifyJWT checks the JWT signature and returns its claims. It is called from the HTTP
+// handlers hence it does not stop the test on failure.
+func verifyJWT(t *testing.T, key *rsa.PublicKey, jwt string) map[string]any {
+	t.Helper()
+
+	claims := map[string]any{}
+
+	parts := strings.Split(jwt, ".")
+	if !assert.Len(t, parts, 3) {
+		return claims
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	assert.NoError(t, err)
+
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	assert.NoError(t, rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature))
+
+	rawClaims, err := base64.RawURLEncoding.DecodeString(parts[1])
+	assert.NoError(t, err)
+	assert.NoError(t, json.Unmarshal(rawClaims, &claims))
+
+	return claims
+}
+
+func TestAppTokenSource(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	pemKey := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	// newTokenEndpoint stands in for the GitHub API minting a new token on every call.
+	newTokenEndpoint := func(t *testing.T) (*httptest.Server, *atomic.Int32) {
+		var minted atomic.Int32
+
+		mux := http.NewServeMux()
+		mux.HandleFunc("GET /orgs/my-org/installation", func(w http.ResponseWriter, r *http.Request) {
+			verifyJWT(t, &key.PublicKey, strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "))
+			_, _ = w.Write([]byte(`{"id": 42}`))
+		})
+		mux.HandleFunc("POST /app/installations/42/access_tokens", func(w http.ResponseWriter, r *http.Request) {
+			claims := verifyJWT(t, &key.PublicKey, strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "))
+			assert.Equal(t, "123", claims["iss"])
+			assert.Equal(t, "2022-11-28", r.Header.Get("X-GitHub-Api-Version"))
+
+			n := minted.Add(1)
+			w.WriteHeader(http.StatusCreated)
+			_, _ = fmt.Fprintf(w, `{"token": "token-%d", "expires_at": %q}`, n, now.Add(time.Hour).Format(time.RFC3339))
+		})
+
+		srv := httptest.NewServer(mux)
+		t.Cleanup(srv.Close)
+
+		return srv, &minted
+	}
+
+	t.Run("mints and caches tokens", func(t *testing.T) {
+		srv, minted := newTokenEndpoint(t)
+
+		ts, err := NewAppTokenSource(AppOptions{AppID: 123, PrivateKey: pemKey, InstallationID: 42, BaseURL: srv.URL})
+		require.NoError(t, err)
+		ts.now = func() time.Time { return now }
+
+		token, err := ts.Token(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, "token-1", token)
+
+		token, err = ts.Token(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, "token-1", token)
+		require.EqualValues(t, 1, minted.Load())
+	})
+
+	t.Run("refreshes tokens before they expire", func(t *testing.T) {
+		srv, minted := newTokenEndpoint(t)
+
+		ts, err := NewAppTokenSource(AppOptions{AppID: 123, PrivateKey: pemKey, InstallationID: 42, BaseURL: srv.URL})
+		require.NoError(t, err)
+		ts.now = func() time.Time { return now }
+
+		token, err := ts.Token(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, "token-1", token)
+
+		ts.now = func() time.Time { return now.Add(56 * time.Minute) }
+
+		token, err = ts.Token(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, "token-2", token)
+		require.EqualValues(t, 2, minted.Load())
+	})
+
+	t.Run("looks up the installation for the organization", func(t *testing.T) {
+		srv, _ := newTokenEndpoint(t)
+
+		ts, err := NewAppTokenSource(AppOptions{AppID: 123, PrivateKey: pemKey, Organization: "my-org", BaseURL: srv.URL})
+		require.NoError(t, err)
+		ts.now = func() time.Time { return now }
+
+		token, err := ts.Token(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, "token-1", token)
+	})
+
+	t.Run("API error", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"message": "A JSON web token could not be decoded"}`))
+		}))
+		t.Cleanup(srv.Close)
+
+		ts, err := NewAppTokenSource(AppOptions{AppID: 123, PrivateKey: pemKey, InstallationID: 42, BaseURL: srv.URL})
+		require.NoError(t, err)
+
+		_, err = ts.Token(context.Background())
+		require.EqualError(t, err, "creating installation token: a json web token could not be decoded with status 401")
+	})
+
+	t.Run("identity", func(t *testing.T) {
+		ts, err := NewAppTokenSource(AppOptions{AppID: 123, PrivateKey: pemKey, InstallationID: 42})
+		require.NoError(t, err)
+		require.Equal(t, "app:123 installation:42", ts.Identity())
+
+		ts, err = NewAppTokenSource(AppOptions{AppID: 123, PrivateKey: pemKey, Organization: "my-org"})
+		require.NoError(t, err)
+		require.Equal(t, "app:123 org:my-org", ts.Identity())
+	})
+
+	t.Run("invalid options", func(t *testing.T) {
+		_, err := NewAppTokenSource(AppOptions{PrivateKey: pemKey, InstallationID: 42})
+		require.Error(t, err)
+
+		_, err = NewAppTokenSource(AppOptions{AppID: 123, PrivateKey: pemKey})
+		require.Error(t, err)
+
+		_, err = NewAppTokenSource(AppOptions{AppID: 123, PrivateKey: []byte("not a key"), InstallationID: 42})
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,400 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	iteratorexec "github.com/jcchavezs/gh-iterator/exec"
+	"github.com/jcchavezs/gh-iterator/internal/log"
+)
+
+// Repository represents a GitHub repository
+type Repository struct {
+	Name              string    `json:"full_name"`
+	URL               string    `json:"clone_url"`
+	SSHURL            string    `json:"ssh_url"`
+	DefaultBranchName string    `json:"default_branch"`
+	Archived          bool      `json:"archived"`
+	Language          string    `json:"language"`
+	Visibility        string    `json:"visibility"`
+	Fork              bool      `json:"fork"`
+	Size              int       `json:"size"`
+	PushedAt          time.Time `json:"pushed_at"`
+}
+
+// TokenSource provides GitHub tokens e.g. short-lived GitHub App installation tokens
+// from AppTokenSource.
+type TokenSource interface {
+	// Token returns a valid token.
+	Token(ctx context.Context) (string, error)
+}
+
+// IdentifiedTokenSource is a TokenSource whose tokens authenticate as a stable identity e.g.
+// AppTokenSource, hence the listing cache is scoped by the identity rather than by the rotating
+// token.
+type IdentifiedTokenSource interface {
+	TokenSource
+	// Identity returns a stable identifier of who the tokens authenticate as.
+	Identity() string
+}
+
+// ListRepositoriesOptions are the options to list the repositories of an organization.
+type ListRepositoriesOptions struct {
+	// PerPage is the number of repositories per page.
+	PerPage int
+	// Page is the page to fetch, ignored when AllPages is set.
+	Page int
+	// AllPages fetches all the pages following the Link headers.
+	AllPages bool
+	// Cache is the duration to cache the responses for. Only supported by the gh CLI client.
+	Cache time.Duration
+	// ListingCache persists the listing to revalidate it with conditional requests or replay it
+	// offline.
+	ListingCache *ListingCache
+}
+
+// Client is a client for the GitHub REST API. The clients created by this package pause the calls
+// when the rate limit is about to be exhausted and retry the rate limited requests.
+//
+// Creating pull requests and forking are not part of the client as CreatePRIfNotExist and
+// ForkAndAddRemote rely on the gh CLI resolving the repository from the git remotes, hence they
+// require the gh CLI even when the client does not.
+type Client interface {
+	// ListOrganizationRepositories lists the repositories of the organization, returning one
+	// slice per page.
+	ListOrganizationRepositories(ctx context.Context, org string, opts ListRepositoriesOptions) ([][]Repository, error)
+	// GetRepository returns the repository with the given full name e.g. owner/repo.
+	GetRepository(ctx context.Context, name string) (Repository, error)
+	// GetFileContent returns the raw content of the file in the default branch of the repository.
+	// If the file does not exist it returns an error wrapping os.ErrNotExist.
+	GetFileContent(ctx context.Context, repo, filePath string) ([]byte, error)
+	// GetAuthenticatedUser returns the login of the user authenticating the calls.
+	GetAuthenticatedUser(ctx context.Context) (string, error)
+}
+
+type clientKey struct{}
+
+// WithClient returns a context carrying the client used by the helpers of this package e.g.
+// ReadFile or CreatePRIfNotExist, hence their calls share the rate limit budget of the client.
+func WithClient(ctx context.Context, c Client) context.Context {
+	return context.WithValue(ctx, clientKey{}, c)
+}
+
+// ClientFromContext returns the client in the context if any.
+func ClientFromContext(ctx context.Context) (Client, bool) {
+	c, ok := ctx.Value(clientKey{}).(Client)
+	return c, ok
+}
+
+// helperClient returns the client in the context or a gh CLI client if none. The gh CLI clients
+// call through xr instead as it carries the authentication of the repository being processed.
+func helperClient(ctx context.Context, xr iteratorexec.Execer) Client {
+	c, ok := ClientFromContext(ctx)
+	if !ok {
+		return NewGHClient(xr)
+	}
+
+	if cc, ok := c.(client); ok {
+		if t, ok := cc.t.(execerTransport); ok {
+			cc.t = t.withExecer(xr)
+			return cc
+		}
+	}
+
+	return c
+}
+
+// limiterFromContext returns the rate limiter of the client in the context if any.
+func limiterFromContext(ctx context.Context) *rateLimiter {
+	if c, ok := ClientFromContext(ctx); ok {
+		if cc, ok := c.(client); ok {
+			return cc.limiter
+		}
+	}
+
+	return nil
+}
+
+// NewGHClient creates a client calling the GitHub API through the gh CLI hence using its
+// authentication and host configuration.
+func NewGHClient(xr iteratorexec.Execer) Client {
+	return NewGHClientForHost(xr, "")
+}
+
+// NewGHClientForHost creates a client calling the GitHub API of the host e.g. a GitHub Enterprise
+// Server hostname through the gh CLI. If host is empty, the host configured in gh is used.
+func NewGHClientForHost(xr iteratorexec.Execer, host string) Client {
+	limiter := newRateLimiter()
+
+	return client{id: "gh:" + host, limiter: limiter, t: rateLimitedTransport{
+		t:       ghTransport{xr: xr, host: host},
+		limiter: limiter,
+	}}
+}
+
+// APIBaseURL returns the base URL of the GitHub API for the host, which is https://api.github.com
+// for github.com or an empty host and https://<host>/api/v3 for GitHub Enterprise Server.
+func APIBaseURL(host string) string {
+	if host == "" || host == "github.com" {
+		return defaultAPIBaseURL
+	}
+
+	return "https://" + host + "/api/v3"
+}
+
+// HTTPClientOptions are the options to create a client calling the GitHub API over HTTP.
+type HTTPClientOptions struct {
+	// BaseURL is the base URL of the GitHub API, by default https://api.github.com. Use APIBaseURL
+	// to target a GitHub Enterprise Server host.
+	BaseURL string
+	// Token is the token to authenticate the requests.
+	Token string
+	// TokenSource provides the token for every request and takes precedence over Token.
+	TokenSource TokenSource
+	// HTTPClient is the client to call the GitHub API, by default http.DefaultClient.
+	HTTPClient *http.Client
+}
+
+// NewHTTPClient creates a client calling the GitHub API over HTTP without requiring the gh CLI.
+func NewHTTPClient(opts HTTPClientOptions) Client {
+	if opts.BaseURL == "" {
+		opts.BaseURL = defaultAPIBaseURL
+	}
+
+	if opts.HTTPClient == nil {
+		opts.HTTPClient = http.DefaultClient
+	}
+
+	baseURL := strings.TrimSuffix(opts.BaseURL, "/")
+
+	limiter := newRateLimiter()
+
+	return client{id: baseURL, limiter: limiter, t: rateLimitedTransport{
+		t: httpTransport{
+			baseURL:     baseURL,
+			httpClient:  opts.HTTPClient,
+			token:       opts.Token,
+			tokenSource: opts.TokenSource,
+		},
+		limiter: limiter,
+	}}
+}
+
+const (
+	acceptJSON = "application/vnd.github+json"
+	acceptRaw  = "application/vnd.github.raw+json"
+)
+
+// client implements Client on top of a transport.
+type client struct {
+	// id identifies the API called by the client.
+	id      string
+	t       transport
+	limiter *rateLimiter
+}
+
+var _ RateLimitReporter = client{}
+
+func (c client) RateLimit() (RateLimit, bool) {
+	if c.limiter == nil {
+		return RateLimit{}, false
+	}
+
+	return c.limiter.budget()
+}
+
+func (c client) ListOrganizationRepositories(ctx context.Context, org string, opts ListRepositoriesOptions) ([][]Repository, error) {
+	query := url.Values{}
+	if opts.PerPage > 0 {
+		query.Set("per_page", strconv.Itoa(opts.PerPage))
+	}
+
+	if !opts.AllPages && opts.Page > 0 {
+		query.Set("page", strconv.Itoa(opts.Page))
+	}
+
+	target := fmt.Sprintf("/orgs/%s/repos", url.PathEscape(org))
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+
+	if opts.ListingCache == nil {
+		var repoPages [][]Repository
+		for target != "" {
+			res, err := c.get(ctx, target, acceptJSON, opts.Cache)
+			if err != nil {
+				return nil, err
+			}
+
+			page, err := unmarshalRepositories(res.body)
+			if err != nil {
+				return nil, err
+			}
+
+			repoPages = append(repoPages, page)
+
+			if !opts.AllPages {
+				break
+			}
+
+			target = nextPageURL(res.header)
+		}
+
+		return repoPages, nil
+	}
+
+	return c.listWithCache(ctx, target, opts)
+}
+
+// listWithCache lists the repositories revalidating the cached pages.
+func (c client) listWithCache(ctx context.Context, target string, opts ListRepositoriesOptions) ([][]Repository, error) {
+	logger := log.FromCtx(ctx)
+
+	// the token is only resolved when there is no stable identity as it can require calling the
+	// API e.g. to mint a GitHub App installation token
+	scope := opts.ListingCache.Scope
+	if scope == "" {
+		scope = c.t.identity()
+	}
+
+	if scope == "" {
+		token, err := c.t.authToken(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("scoping listing cache: %w", err)
+		}
+
+		scope = tokenScope(token)
+	}
+
+	key := fmt.Sprintf("%s %s %s all_pages=%t", c.id, scope, target, opts.AllPages)
+	cached, err := opts.ListingCache.load(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.ListingCache.Offline {
+		if cached == nil {
+			return nil, fmt.Errorf("%w: %s", ErrListingNotCached, target)
+		}
+
+		logger.Debug("Replaying cached listing", "target", target)
+		return cached.repoPages(), nil
+	}
+
+	listing := cachedListing{Key: key}
+	for target != "" {
+		prevPage, hasPrevPage := cached.page(target)
+
+		req := apiRequest{method: http.MethodGet, path: target, accept: acceptJSON, cache: opts.Cache}
+		if hasPrevPage {
+			req.ifNoneMatch = prevPage.ETag
+		}
+
+		res, err := c.t.do(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+
+		page := prevPage
+		if res.status == http.StatusNotModified && hasPrevPage {
+			logger.Debug("Listing page not modified", "target", target)
+		} else if res.status >= http.StatusMultipleChoices {
+			return nil, newAPIError(res.status, res.body)
+		} else {
+			repos, err := unmarshalRepositories(res.body)
+			if err != nil {
+				return nil, err
+			}
+
+			page = cachedPage{URL: target, ETag: res.header.Get("ETag"), Next: nextPageURL(res.header), Repositories: repos}
+		}
+
+		listing.Pages = append(listing.Pages, page)
+
+		if !opts.AllPages {
+			break
+		}
+
+		target = page.Next
+	}
+
+	if err := opts.ListingCache.save(listing); err != nil {
+		logger.Warn("Failed to cache listing", "error", err)
+	}
+
+	return listing.repoPages(), nil
+}
+
+func unmarshalRepositories(payload []byte) ([]Repository, error) {
+	var page = []Repository{}
+	if err := json.Unmarshal(payload, &page); err != nil {
+		return nil, fmt.Errorf("unmarshaling repositories: %w", err)
+	}
+
+	return page, nil
+}
+
+func (c client) GetRepository(ctx context.Context, name string) (Repository, error) {
+	res, err := c.get(ctx, "/repos/"+name, acceptJSON, 0)
+	if err != nil {
+		return Repository{}, err
+	}
+
+	var repo Repository
+	if err := json.Unmarshal(res.body, &repo); err != nil {
+		return Repository{}, fmt.Errorf("unmarshaling repository: %w", err)
+	}
+
+	return repo, nil
+}
+
+func (c client) GetFileContent(ctx context.Context, repo, filePath string) ([]byte, error) {
+	res, err := c.get(ctx, fmt.Sprintf("/repos/%s/contents/%s", repo, filePath), acceptRaw, 0)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return nil, fmt.Errorf("%w: %w", os.ErrNotExist, err)
+		}
+
+		return nil, err
+	}
+
+	return res.body, nil
+}
+
+func (c client) GetAuthenticatedUser(ctx context.Context) (string, error) {
+	res, err := c.get(ctx, "/user", acceptJSON, 0)
+	if err != nil {
+		return "", err
+	}
+
+	var user struct {
+		Login string `json:"login"`
+	}
+	if err := json.Unmarshal(res.body, &user); err != nil {
+		return "", fmt.Errorf("unmarshaling user: %w", err)
+	}
+
+	return user.Login, nil
+}
+
+// get sends a GET request and returns an *APIError when the response is not successful.
+func (c client) get(ctx context.Context, target, accept string, cache time.Duration) (apiResponse, error) {
+	res, err := c.t.do(ctx, apiRequest{method: http.MethodGet, path: target, accept: accept, cache: cache})
+	if err != nil {
+		return apiResponse{}, err
+	}
+
+	if res.status >= http.StatusMultipleChoices {
+		return apiResponse{}, newAPIError(res.status, res.body)
+	}
+
+	return res, nil
+}
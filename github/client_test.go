@@ -0,0 +1,237 @@
+package github
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jcchavezs/gh-iterator/exec/mock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ghResponse formats a response as printed by `gh api --include`.
+func ghResponse(status int, body string, headers ...string) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "HTTP/2.0 %d %s\r\n", status, http.StatusText(status))
+	for i := 0; i+1 < len(headers); i += 2 {
+		fmt.Fprintf(&sb, "%s: %s\r\n", headers[i], headers[i+1])
+	}
+	sb.WriteString("\r\n")
+	sb.WriteString(body)
+
+	return sb.String()
+}
+
+func TestHTTPClient(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /orgs/my-org/repos", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer my-token", r.Header.Get("Authorization"))
+		assert.Equal(t, "2", r.URL.Query().Get("per_page"))
+
+		switch r.URL.Query().Get("page") {
+		case "", "1":
+			w.Header().Set("Link", fmt.Sprintf(`<http://%s/orgs/my-org/repos?per_page=2&page=2>; rel="next", <http://%s/orgs/my-org/repos?per_page=2&page=2>; rel="last"`, r.Host, r.Host))
+			_, _ = w.Write([]byte(`[{"full_name":"my-org/repo-1","size":1},{"full_name":"my-org/repo-2"}]`))
+		case "2":
+			_, _ = w.Write([]byte(`[{"full_name":"my-org/repo-3"}]`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+	mux.HandleFunc("GET /repos/my-org/repo-1", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"full_name":"my-org/repo-1","default_branch":"main","archived":true}`))
+	})
+	mux.HandleFunc("GET /repos/my-org/repo-1/contents/README.md", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "application/vnd.github.raw+json", r.Header.Get("Accept"))
+		_, _ = w.Write([]byte("Hello world!"))
+	})
+	mux.HandleFunc("GET /user", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"login":"my-user"}`))
+	})
+	mux.HandleFunc("GET /repos/my-org/repo-1/contents/", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"message":"Not Found","status":"404"}`))
+	})
+
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	client := NewHTTPClient(HTTPClientOptions{BaseURL: srv.URL + "/", Token: "my-token"})
+	ctx := context.Background()
+
+	t.Run("list all pages", func(t *testing.T) {
+		repoPages, err := client.ListOrganizationRepositories(ctx, "my-org", ListRepositoriesOptions{PerPage: 2, AllPages: true})
+		require.NoError(t, err)
+		require.Len(t, repoPages, 2)
+		require.Len(t, repoPages[0], 2)
+		require.Equal(t, "my-org/repo-1", repoPages[0][0].Name)
+		require.Equal(t, 1, repoPages[0][0].Size)
+		require.Equal(t, "my-org/repo-3", repoPages[1][0].Name)
+	})
+
+	t.Run("list single page", func(t *testing.T) {
+		repoPages, err := client.ListOrganizationRepositories(ctx, "my-org", ListRepositoriesOptions{PerPage: 2, Page: 2})
+		require.NoError(t, err)
+		require.Len(t, repoPages, 1)
+		require.Equal(t, "my-org/repo-3", repoPages[0][0].Name)
+	})
+
+	t.Run("get repository", func(t *testing.T) {
+		repo, err := client.GetRepository(ctx, "my-org/repo-1")
+		require.NoError(t, err)
+		require.Equal(t, "main", repo.DefaultBranchName)
+		require.True(t, repo.Archived)
+	})
+
+	t.Run("get file content", func(t *testing.T) {
+		content, err := client.GetFileContent(ctx, "my-org/repo-1", "README.md")
+		require.NoError(t, err)
+		require.Equal(t, "Hello world!", string(content))
+	})
+
+	t.Run("get missing file content", func(t *testing.T) {
+		_, err := client.GetFileContent(ctx, "my-org/repo-1", "missing.md")
+		require.ErrorIs(t, err, os.ErrNotExist)
+	})
+
+	t.Run("get authenticated user", func(t *testing.T) {
+		login, err := client.GetAuthenticatedUser(ctx)
+		require.NoError(t, err)
+		require.Equal(t, "my-user", login)
+	})
+
+	t.Run("api error", func(t *testing.T) {
+		_, err := client.GetRepository(ctx, "my-org/unknown")
+		require.ErrorIs(t, err, ErrNotFound)
+		require.ErrorContains(t, err, "not found with status 404")
+	})
+}
+
+func TestHTTPClientTokenSource(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer refreshed-token", r.Header.Get("Authorization"))
+		_, _ = w.Write([]byte(`{"full_name":"my-org/repo-1"}`))
+	}))
+	defer srv.Close()
+
+	client := NewHTTPClient(HTTPClientOptions{
+		BaseURL:     srv.URL,
+		Token:       "my-token",
+		TokenSource: tokenSourceFunc(func(context.Context) (string, error) { return "refreshed-token", nil }),
+	})
+
+	repo, err := client.GetRepository(context.Background(), "my-org/repo-1")
+	require.NoError(t, err)
+	require.Equal(t, "my-org/repo-1", repo.Name)
+}
+
+type tokenSourceFunc func(context.Context) (string, error)
+
+func (f tokenSourceFunc) Token(ctx context.Context) (string, error) {
+	return f(ctx)
+}
+
+func TestGHClient(t *testing.T) {
+	t.Run("list all pages", func(t *testing.T) {
+		var calls int
+		x := mock.Execer{
+			RunXFn: func(ctx context.Context, command string, args ...string) (string, error) {
+				calls++
+				switch {
+				case mock.CallIs(t, command, args, "gh", "api", "--include", "-X", "GET", mock.CallAny, mock.CallAny, mock.CallAny, mock.CallAny, "--cache", "1h0m0s", "/orgs/my-org/repos?per_page=1"):
+					return ghResponse(200, `[{"full_name":"my-org/repo-1"}]`,
+						"Link", `<https://ghe.example.com/api/v3/organizations/1/repos?per_page=1&page=2>; rel="next"`,
+					), nil
+				case mock.CallIs(t, command, args, "gh", "api", "--include", "-X", "GET", mock.CallAny, mock.CallAny, mock.CallAny, mock.CallAny, "--cache", "1h0m0s", "/organizations/1/repos?per_page=1&page=2"):
+					return ghResponse(200, `[{"full_name":"my-org/repo-2"}]`), nil
+				}
+
+				return "", mock.ErrUnexpectedCall
+			},
+			Logger: slog.New(slog.DiscardHandler),
+		}
+
+		repoPages, err := NewGHClient(x).ListOrganizationRepositories(context.Background(), "my-org", ListRepositoriesOptions{
+			PerPage:  1,
+			AllPages: true,
+			Cache:    time.Hour,
+		})
+		require.NoError(t, err)
+		require.Equal(t, 2, calls)
+		require.Equal(t, [][]Repository{{{Name: "my-org/repo-1"}}, {{Name: "my-org/repo-2"}}}, repoPages)
+	})
+
+	t.Run("host", func(t *testing.T) {
+		x := mock.Execer{
+			RunXFn: func(ctx context.Context, command string, args ...string) (string, error) {
+				if mock.CallIs(t, command, args, "gh", "api", "--include", "-X", "GET", mock.CallAny, mock.CallAny, mock.CallAny, mock.CallAny, "--hostname", "ghe.example.com", "/repos/my-org/repo-1") {
+					return ghResponse(200, `{"full_name":"my-org/repo-1"}`), nil
+				}
+
+				return "", mock.ErrUnexpectedCall
+			},
+			Logger: slog.New(slog.DiscardHandler),
+		}
+
+		repo, err := NewGHClientForHost(x, "ghe.example.com").GetRepository(context.Background(), "my-org/repo-1")
+		require.NoError(t, err)
+		require.Equal(t, "my-org/repo-1", repo.Name)
+	})
+
+	t.Run("offline listing is scoped by the gh token", func(t *testing.T) {
+		newClient := func(token string) Client {
+			return NewGHClientForHost(mock.Execer{
+				RunXFn: func(ctx context.Context, command string, args ...string) (string, error) {
+					if mock.CallIs(t, command, args, "gh", "auth", "token", "--hostname", "ghe.example.com") {
+						return token + "\n", nil
+					}
+
+					if mock.CallIs(t, command, args, "gh", "api", "--include", "-X", "GET", mock.CallAny, mock.CallAny, mock.CallAny, mock.CallAny, "--hostname", "ghe.example.com", "/orgs/my-org/repos") {
+						return ghResponse(200, `[{"full_name":"my-org/repo-1"}]`), nil
+					}
+
+					return "", mock.ErrUnexpectedCall
+				},
+				Logger: slog.New(slog.DiscardHandler),
+			}, "ghe.example.com")
+		}
+
+		dir := t.TempDir()
+		_, err := newClient("token-1").ListOrganizationRepositories(context.Background(), "my-org", ListRepositoriesOptions{ListingCache: &ListingCache{Dir: dir}})
+		require.NoError(t, err)
+
+		offline := ListRepositoriesOptions{ListingCache: &ListingCache{Dir: dir, Offline: true}}
+
+		repoPages, err := newClient("token-1").ListOrganizationRepositories(context.Background(), "my-org", offline)
+		require.NoError(t, err)
+		require.Equal(t, [][]Repository{{{Name: "my-org/repo-1"}}}, repoPages)
+
+		_, err = newClient("token-2").ListOrganizationRepositories(context.Background(), "my-org", offline)
+		require.ErrorIs(t, err, ErrListingNotCached)
+	})
+
+	t.Run("error without response", func(t *testing.T) {
+		x := mock.Execer{
+			RunXFn: func(ctx context.Context, command string, args ...string) (string, error) {
+				return "", fmt.Errorf("gh not found")
+			},
+			Logger: slog.New(slog.DiscardHandler),
+		}
+
+		_, err := NewGHClient(x).GetRepository(context.Background(), "my-org/repo-1")
+		require.ErrorContains(t, err, "gh not found")
+	})
+}
+
+func TestAPIBaseURL(t *testing.T) {
+	require.Equal(t, "https://api.github.com", APIBaseURL(""))
+	require.Equal(t, "https://api.github.com", APIBaseURL("github.com"))
+	require.Equal(t, "https://ghe.example.com/api/v3", APIBaseURL("ghe.example.com"))
+}
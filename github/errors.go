@@ -0,0 +1,110 @@
+package github
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrNotFound matches API errors with status 404.
+	ErrNotFound = errors.New("not found")
+	// ErrForbidden matches API errors with status 403, including the rate limited ones.
+	ErrForbidden = errors.New("forbidden")
+	// ErrRateLimited matches API errors caused by primary or secondary rate limits.
+	ErrRateLimited = errors.New("rate limited")
+	// ErrValidation matches API errors with status 422 i.e. the request failed validation.
+	ErrValidation = errors.New("validation failed")
+)
+
+// ValidationError is the detail of a validation failure in an APIError.
+type ValidationError struct {
+	Resource string `json:"resource"`
+	Field    string `json:"field"`
+	Code     string `json:"code"`
+	Message  string `json:"message"`
+}
+
+func (e ValidationError) String() string {
+	if e.Message != "" {
+		return e.Message
+	}
+
+	return fmt.Sprintf("%s %s %s", e.Resource, e.Field, e.Code)
+}
+
+// APIError is an error response from the GitHub API. It can be matched with errors.Is against
+// ErrNotFound, ErrForbidden, ErrRateLimited and ErrValidation.
+type APIError struct {
+	// StatusCode is the HTTP status code of the response.
+	StatusCode int
+	// Message is the error message.
+	Message string `json:"message"`
+	// DocumentationURL is the link to the documentation about the error.
+	DocumentationURL string `json:"documentation_url"`
+	// Errors are the details of the validation failures.
+	Errors []ValidationError `json:"errors"`
+}
+
+func (e *APIError) Error() string {
+	msg := fmt.Sprintf("%s with status %d", strings.ToLower(e.Message), e.StatusCode)
+	if len(e.Errors) > 0 {
+		details := make([]string, len(e.Errors))
+		for i, ve := range e.Errors {
+			details[i] = ve.String()
+		}
+
+		msg += ": " + strings.Join(details, ", ")
+	}
+
+	return msg
+}
+
+// Is matches the error against the sentinel errors of this package.
+func (e *APIError) Is(target error) bool {
+	switch target {
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case ErrForbidden:
+		return e.StatusCode == http.StatusForbidden
+	case ErrRateLimited:
+		return e.StatusCode == http.StatusTooManyRequests ||
+			(e.StatusCode == http.StatusForbidden && strings.Contains(strings.ToLower(e.Message), "rate limit"))
+	case ErrValidation:
+		return e.StatusCode == http.StatusUnprocessableEntity
+	}
+
+	return false
+}
+
+// newAPIError creates an APIError from the status code and the response payload.
+func newAPIError(statusCode int, payload []byte) *APIError {
+	apiErr := &APIError{}
+	_ = json.Unmarshal(payload, apiErr)
+	apiErr.StatusCode = statusCode
+	if apiErr.Message == "" {
+		apiErr.Message = http.StatusText(statusCode)
+	}
+
+	return apiErr
+}
+
+// parseAPIError parses the payload printed by gh on failure, which includes the status code.
+func parseAPIError(payload string) (*APIError, bool) {
+	var res struct {
+		APIError
+		Status string `json:"status"`
+	}
+
+	if err := json.NewDecoder(strings.NewReader(payload)).Decode(&res); err != nil {
+		return nil, false
+	}
+
+	apiErr := res.APIError
+	apiErr.StatusCode, _ = strconv.Atoi(res.Status)
+
+	return &apiErr, true
+}
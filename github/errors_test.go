@@ -0,0 +1,69 @@
+package github
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPIErrorIs(t *testing.T) {
+	testCases := map[string]struct {
+		err      *APIError
+		matching []error
+	}{
+		"not found":          {err: &APIError{StatusCode: 404, Message: "Not Found"}, matching: []error{ErrNotFound}},
+		"forbidden":          {err: &APIError{StatusCode: 403, Message: "Resource not accessible by integration"}, matching: []error{ErrForbidden}},
+		"primary rate limit": {err: &APIError{StatusCode: 403, Message: "API rate limit exceeded"}, matching: []error{ErrForbidden, ErrRateLimited}},
+		"too many requests":  {err: &APIError{StatusCode: 429, Message: "Too Many Requests"}, matching: []error{ErrRateLimited}},
+		"validation":         {err: &APIError{StatusCode: 422, Message: "Validation Failed"}, matching: []error{ErrValidation}},
+		"server error":       {err: &APIError{StatusCode: 500, Message: "Internal Server Error"}},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			err := fmt.Errorf("calling API: %w", tc.err)
+			for _, target := range []error{ErrNotFound, ErrForbidden, ErrRateLimited, ErrValidation} {
+				require.Equal(t, contains(tc.matching, target), errors.Is(err, target), "matching %v", target)
+			}
+		})
+	}
+}
+
+func contains(errs []error, target error) bool {
+	for _, err := range errs {
+		if err == target {
+			return true
+		}
+	}
+
+	return false
+}
+
+func TestNewAPIError(t *testing.T) {
+	apiErr := newAPIError(422, []byte(`{
+		"message": "Validation Failed",
+		"errors": [{"resource": "PullRequest", "code": "custom", "message": "A pull request already exists"}],
+		"documentation_url": "https://docs.github.com/rest/pulls/pulls#create-a-pull-request"
+	}`))
+
+	require.Equal(t, 422, apiErr.StatusCode)
+	require.Equal(t, "https://docs.github.com/rest/pulls/pulls#create-a-pull-request", apiErr.DocumentationURL)
+	require.Equal(t, "validation failed with status 422: A pull request already exists", apiErr.Error())
+
+	require.Equal(t, "Bad Gateway", newAPIError(502, []byte("<html></html>")).Message)
+}
+
+func TestErrOrGHAPIErr(t *testing.T) {
+	genericErr := errors.New("exit status 1")
+
+	err := ErrOrGHAPIErr(`{"message":"Not Found","documentation_url":"https://docs.github.com","status":"404"}`, genericErr)
+	require.ErrorIs(t, err, ErrNotFound)
+
+	var apiErr *APIError
+	require.ErrorAs(t, err, &apiErr)
+	require.Equal(t, "Not Found", apiErr.Message)
+
+	require.Equal(t, genericErr, ErrOrGHAPIErr("no JSON", genericErr))
+}
@@ -14,22 +14,12 @@ import (
 	"github.com/jcchavezs/gh-iterator/internal/log"
 )
 
-type ghErrResponse struct {
-	Message string `json:"message"`
-	Status  string `json:"status"`
-}
-
-func (r ghErrResponse) Error() string {
-	return fmt.Sprintf("%s with status %s", strings.ToLower(r.Message), r.Status)
-}
-
-// ErrOrGHAPIErr unmarshals the response payload and if it success return the GH API error,
-// otherwise returns the generic error.
+// ErrOrGHAPIErr unmarshals the response payload and if it success return the GH API error
+// as an *APIError, otherwise returns the generic error.
 func ErrOrGHAPIErr(apiResponsePayload string, err error) error {
 	if len(apiResponsePayload) > 0 {
-		var errRes ghErrResponse
-		if dErr := json.NewDecoder(strings.NewReader(apiResponsePayload)).Decode(&errRes); dErr == nil {
-			return errRes
+		if apiErr, ok := parseAPIError(apiResponsePayload); ok {
+			return apiErr
 		}
 	}
 
@@ -168,7 +158,8 @@ type PROptions struct {
 
 const prBodyMaxLen = 5000 // arbitrary but I think it is enough
 
-// CreatePRIfNotExist on GitHub and returns:
+// CreatePRIfNotExist on GitHub using the gh CLI, which is required even when the client in the
+// context does not, paused while that client is rate limited (see WithClient). It returns:
 // - The PR URL
 // - Whether the PR is new or not
 // - An error if occurred.
@@ -206,7 +197,7 @@ func CreatePRIfNotExist(ctx context.Context, xr iteratorexec.Execer, opts PROpti
 	}
 	prViewArgs = append(prViewArgs, "--json", "url,state,isDraft")
 
-	if res, err := xr.Run(ctx, "gh", prViewArgs...); err != nil {
+	if res, err := runGH(ctx, xr, prViewArgs...); err != nil {
 		return "", false, fmt.Errorf("checking existing PR: %w", err)
 	} else if res.ExitCode == 0 {
 		// PR exists
@@ -262,7 +253,7 @@ func CreatePRIfNotExist(ctx context.Context, xr iteratorexec.Execer, opts PROpti
 			}
 		}
 
-		res, err := xr.RunX(ctx, "gh", createPRArgs...)
+		res, err := runGHX(ctx, xr, createPRArgs...)
 		if err != nil {
 			return "", false, fmt.Errorf("failed to create PR: %w", ErrOrGHAPIErr(res, err))
 		}
@@ -291,7 +282,7 @@ func CreatePRIfNotExist(ctx context.Context, xr iteratorexec.Execer, opts PROpti
 			}
 		}
 
-		res, err := xr.RunX(ctx, "gh", editPRArgs...)
+		res, err := runGHX(ctx, xr, editPRArgs...)
 		if err != nil {
 			return "", false, fmt.Errorf("failed to update PR: %w", ErrOrGHAPIErr(res, err))
 		}
@@ -305,7 +296,7 @@ func CreatePRIfNotExist(ctx context.Context, xr iteratorexec.Execer, opts PROpti
 				toggleDraftArgs = append(toggleDraftArgs, "--undo")
 			}
 
-			if _, err := xr.RunX(ctx, "gh", toggleDraftArgs...); err != nil {
+			if _, err := runGHX(ctx, xr, toggleDraftArgs...); err != nil {
 				return "", false, fmt.Errorf("failed to toggle draft status: %w", ErrOrGHAPIErr(res, err))
 			}
 		}
@@ -317,6 +308,8 @@ func CreatePRIfNotExist(ctx context.Context, xr iteratorexec.Execer, opts PROpti
 // ForkAndAddRemote a repository and add the remote to the local git config.
 // It returns a function that given a branch name returns the head reference
 // to be used in the PR creation (i.e., username:branchName).
+// The current user is retrieved with the client in the context if any (see WithClient) but forking
+// requires the gh CLI, whose commands are paused while that client is rate limited.
 // Important: if you name the remote as 'upstream', gh CLI might get confused when creating PRs.
 func ForkAndAddRemote(ctx context.Context, xr iteratorexec.Execer, remoteName string) (func(branchName string) string, error) {
 	username, err := getCurrentUser(ctx, xr)
@@ -324,7 +317,7 @@ func ForkAndAddRemote(ctx context.Context, xr iteratorexec.Execer, remoteName st
 		return nil, err
 	}
 
-	_, err = xr.RunX(ctx, "gh", "repo", "fork", "--remote", "--remote-name", remoteName)
+	_, err = runGHX(ctx, xr, "repo", "fork", "--remote", "--remote-name", remoteName)
 	if err != nil {
 		return nil, fmt.Errorf("forking repository and adding remote: %w", err)
 	}
@@ -335,7 +328,7 @@ func ForkAndAddRemote(ctx context.Context, xr iteratorexec.Execer, remoteName st
 }
 
 func getCurrentUser(ctx context.Context, xr iteratorexec.Execer) (string, error) {
-	res, err := iteratorexec.TrimStdout(xr.RunX(ctx, "gh", "api", "user", "--jq", ".login"))
+	res, err := helperClient(ctx, xr).GetAuthenticatedUser(ctx)
 	if err != nil {
 		return "", fmt.Errorf("getting current user: %w", err)
 	}
@@ -343,49 +336,27 @@ func getCurrentUser(ctx context.Context, xr iteratorexec.Execer) (string, error)
 	return res, nil
 }
 
-type ghAPIErrorResponse struct {
-	Message string `json:"message"`
-	Status  string `json:"status"`
-}
-
-// IsRepositoryArchived checks if the repository is archived by querying the GitHub API.
+// IsRepositoryArchived checks if the repository is archived by querying the GitHub API through the
+// client in the context if any (see WithClient), otherwise the gh CLI.
 func IsRepositoryArchived(ctx context.Context, repoName string, xr iteratorexec.Execer) (bool, error) {
 	xr.Log(ctx, slog.LevelDebug, "Checking if repository is archived")
 
-	res, err := xr.RunX(ctx, "gh", "api",
-		fmt.Sprintf("/repos/%s", repoName),
-		"-H", "Accept: application/vnd.github+json",
-		"--jq", ".archived")
-	if err == nil {
-		return strings.Contains(res, "true"), nil
-	}
-
-	var errResponse ghAPIErrorResponse
-	if err := json.Unmarshal([]byte(res), &errResponse); err == nil {
-		return false, fmt.Errorf("checking if repository is archived: %s", errResponse.Message)
+	repo, err := helperClient(ctx, xr).GetRepository(ctx, repoName)
+	if err != nil {
+		return false, fmt.Errorf("checking if repository is archived: %w", err)
 	}
 
-	return false, fmt.Errorf("checking if repository is archived: %w", err)
+	return repo.Archived, nil
 }
 
+// ReadFile reads a file from the default branch of the repository using the client in the context
+// if any (see WithClient), otherwise the gh CLI. If the file does not exist it returns an error
+// wrapping os.ErrNotExist.
 func ReadFile(ctx context.Context, xr iteratorexec.Execer, repo string, filePath string) ([]byte, error) {
-	out, err := xr.RunX(ctx, "gh", "api",
-		fmt.Sprintf("/repos/%s/contents/%s", repo, filePath),
-		"-H", "Accept: application/vnd.github.raw+json",
-	)
-
-	if err == nil {
-		return []byte(out), nil
-	}
-
-	var errResponse ghErrResponse
-	if err := json.Unmarshal([]byte(out), &errResponse); err == nil {
-		if errResponse.Status == "404" {
-			return nil, fmt.Errorf("reading file %q: %w", filePath, os.ErrNotExist)
-		}
-
-		return nil, fmt.Errorf("reading file %q: %s", filePath, errResponse.Message)
+	content, err := helperClient(ctx, xr).GetFileContent(ctx, repo, filePath)
+	if err != nil {
+		return nil, fmt.Errorf("reading file %q: %w", filePath, err)
 	}
 
-	return nil, fmt.Errorf("reading file %q: %w", filePath, err)
+	return content, nil
 }
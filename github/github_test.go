@@ -269,7 +269,7 @@ func TestIsRepositoryArchived(t *testing.T) {
 	t.Run("archived repository", func(t *testing.T) {
 		x := mock.Execer{
 			RunXFn: func(ctx context.Context, command string, args ...string) (string, error) {
-				return "true\n", nil
+				return ghResponse(200, `{"full_name":"owner/repo","archived":true}`), nil
 			},
 			Logger: slog.New(slog.DiscardHandler),
 		}
@@ -282,7 +282,7 @@ func TestIsRepositoryArchived(t *testing.T) {
 	t.Run("non-archived repository", func(t *testing.T) {
 		x := mock.Execer{
 			RunXFn: func(ctx context.Context, command string, args ...string) (string, error) {
-				return "false\n", nil
+				return ghResponse(200, `{"full_name":"owner/repo","archived":false}`), nil
 			},
 			Logger: slog.New(slog.DiscardHandler),
 		}
@@ -312,8 +312,13 @@ func TestReadFile(t *testing.T) {
 		x := mock.Execer{
 			RunXFn: func(ctx context.Context, command string, args ...string) (string, error) {
 				require.Equal(t, "gh", command)
-				require.Equal(t, []string{"api", "/repos/owner/repo/contents/path/to/file.txt", "-H", "Accept: application/vnd.github.raw+json"}, args)
-				return "file contents", nil
+				require.Equal(t, []string{"api", "--include",
+					"-X", "GET",
+					"-H", "Accept: application/vnd.github.raw+json",
+					"-H", "X-GitHub-Api-Version: 2022-11-28",
+					"/repos/owner/repo/contents/path/to/file.txt",
+				}, args)
+				return ghResponse(200, "file contents"), nil
 			},
 			Logger: slog.New(slog.DiscardHandler),
 		}
@@ -326,7 +331,7 @@ func TestReadFile(t *testing.T) {
 	t.Run("file not found", func(t *testing.T) {
 		x := mock.Execer{
 			RunXFn: func(ctx context.Context, command string, args ...string) (string, error) {
-				return `{"message":"Not Found","status":"404"}`, errors.New("exit status 1")
+				return ghResponse(404, `{"message":"Not Found","status":"404"}`), errors.New("exit status 1")
 			},
 			Logger: slog.New(slog.DiscardHandler),
 		}
@@ -339,14 +344,14 @@ func TestReadFile(t *testing.T) {
 	t.Run("api error with message", func(t *testing.T) {
 		x := mock.Execer{
 			RunXFn: func(ctx context.Context, command string, args ...string) (string, error) {
-				return `{"message":"Bad credentials","status":"401"}`, errors.New("exit status 1")
+				return ghResponse(401, `{"message":"Bad credentials","status":"401"}`), errors.New("exit status 1")
 			},
 			Logger: slog.New(slog.DiscardHandler),
 		}
 
 		content, err := ReadFile(context.Background(), x, "owner/repo", "file.txt")
 		require.Error(t, err)
-		require.Contains(t, err.Error(), "Bad credentials")
+		require.Contains(t, err.Error(), "bad credentials")
 		require.Nil(t, content)
 	})
 
@@ -363,14 +368,36 @@ func TestReadFile(t *testing.T) {
 		require.Contains(t, err.Error(), "network failure")
 		require.Nil(t, content)
 	})
+
+	t.Run("gh client in the context", func(t *testing.T) {
+		runXer := mock.Execer{
+			RunXFn: func(ctx context.Context, command string, args ...string) (string, error) {
+				return "", errors.New("unexpected call to the execer of the run")
+			},
+		}
+
+		x := mock.Execer{
+			RunXFn: func(ctx context.Context, command string, args ...string) (string, error) {
+				return ghResponse(200, "file contents"), nil
+			},
+			Logger: slog.New(slog.DiscardHandler),
+		}
+
+		// the gh CLI client calls through the execer of the repository carrying its authentication
+		ctx := WithClient(context.Background(), NewGHClient(runXer))
+		content, err := ReadFile(ctx, x, "owner/repo", "file.txt")
+		require.NoError(t, err)
+		require.Equal(t, []byte("file contents"), content)
+	})
 }
 
 func TestForkAndAddRemote(t *testing.T) {
 	t.Run("successful fork and add remote", func(t *testing.T) {
 		x := mock.Execer{
 			RunXFn: func(ctx context.Context, command string, args ...string) (string, error) {
-				if mock.CallIs(t, command, args, "gh", "api", "user", "--jq", ".login") {
-					return "testuser", nil
+				if mock.CallIs(t, command, args, "gh", "api") {
+					require.Equal(t, "/user", args[len(args)-1])
+					return ghResponse(200, `{"login":"testuser"}`), nil
 				}
 				if mock.CallIs(t, command, args, "gh", "repo", "fork", "--remote", "--remote-name", "upstream") {
 					return "", nil
@@ -412,7 +439,7 @@ func TestForkAndAddRemote(t *testing.T) {
 		x := mock.Execer{
 			RunXFn: func(ctx context.Context, command string, args ...string) (string, error) {
 				if mock.CallIs(t, command, args, "gh", "api") {
-					return "testuser", nil
+					return ghResponse(200, `{"login":"testuser"}`), nil
 				}
 				if mock.CallIs(t, command, args, "gh", "repo", "fork") {
 					return "", errors.New("failed to fork repository")
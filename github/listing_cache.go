@@ -0,0 +1,150 @@
+package github
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// ErrListingNotCached is returned in offline mode when there is no cached listing for the query.
+var ErrListingNotCached = errors.New("listing not cached")
+
+// ListingCache persists the organization listings on disk keyed by API, identity, organization
+// and query. The cached pages are revalidated with conditional requests (If-None-Match) hence
+// unchanged pages do not count against the rate limit.
+type ListingCache struct {
+	// Dir is the directory to store the listings, by default gh-iterator/listings in the user
+	// cache directory.
+	Dir string
+	// Offline replays the last cached listing without calling the API.
+	Offline bool
+	// Scope identifies who lists the repositories e.g. the authenticated login, as the listing
+	// depends on what the identity can see. By default it is the identity of the token source if
+	// it is an IdentifiedTokenSource e.g. AppTokenSource, otherwise a hash of the token. Set it to
+	// a stable value when the token rotates. When set, no token is resolved in Offline mode.
+	Scope string
+}
+
+// tokenScope returns the scope of the listings listed with the token.
+func tokenScope(token string) string {
+	if token == "" {
+		return "anonymous"
+	}
+
+	return fmt.Sprintf("token:%x", sha256.Sum256([]byte(token)))
+}
+
+// cachedListing is the listing of an organization as stored on disk.
+type cachedListing struct {
+	Key   string       `json:"key"`
+	Pages []cachedPage `json:"pages"`
+}
+
+// cachedPage is a page of a listing with the ETag to revalidate it.
+type cachedPage struct {
+	URL          string       `json:"url"`
+	ETag         string       `json:"etag"`
+	Next         string       `json:"next,omitempty"`
+	Repositories []Repository `json:"repositories"`
+}
+
+func (l *cachedListing) page(url string) (cachedPage, bool) {
+	if l == nil {
+		return cachedPage{}, false
+	}
+
+	for _, p := range l.Pages {
+		if p.URL == url {
+			return p, true
+		}
+	}
+
+	return cachedPage{}, false
+}
+
+func (l *cachedListing) repoPages() [][]Repository {
+	repoPages := make([][]Repository, len(l.Pages))
+	for i, p := range l.Pages {
+		repoPages[i] = p.Repositories
+	}
+
+	return repoPages
+}
+
+func (c *ListingCache) path(key string) (string, error) {
+	dir := c.Dir
+	if dir == "" {
+		userCacheDir, err := os.UserCacheDir()
+		if err != nil {
+			return "", fmt.Errorf("getting user cache directory: %w", err)
+		}
+
+		dir = filepath.Join(userCacheDir, "gh-iterator", "listings")
+	}
+
+	return filepath.Join(dir, fmt.Sprintf("%x.json", sha256.Sum256([]byte(key)))), nil
+}
+
+// load returns the cached listing for the key or nil if it does not exist.
+func (c *ListingCache) load(key string) (*cachedListing, error) {
+	p, err := c.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := os.ReadFile(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("reading cached listing: %w", err)
+	}
+
+	var listing cachedListing
+	if err := json.Unmarshal(content, &listing); err != nil {
+		return nil, fmt.Errorf("unmarshaling cached listing: %w", err)
+	}
+
+	// hash collisions are very unlikely but cheap to rule out
+	if listing.Key != key {
+		return nil, nil
+	}
+
+	return &listing, nil
+}
+
+// save stores the listing replacing the previous one atomically.
+func (c *ListingCache) save(listing cachedListing) error {
+	p, err := c.path(listing.Key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return fmt.Errorf("creating cache directory: %w", err)
+	}
+
+	content, err := json.Marshal(listing)
+	if err != nil {
+		return fmt.Errorf("marshaling listing: %w", err)
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(p), "listing-*")
+	if err != nil {
+		return fmt.Errorf("creating cached listing: %w", err)
+	}
+	defer os.Remove(f.Name()) //nolint:errcheck
+
+	if _, err := f.Write(content); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("writing cached listing: %w", err)
+	}
+
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("writing cached listing: %w", err)
+	}
+
+	return os.Rename(f.Name(), p)
+}
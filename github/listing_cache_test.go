@@ -0,0 +1,173 @@
+package github
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestListingCache(t *testing.T) {
+	var (
+		fullResponses atomic.Int32
+		repo2Name     atomic.Value
+	)
+	repo2Name.Store("my-org/repo-2")
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var (
+			etag, body string
+			next       bool
+		)
+
+		switch r.URL.Query().Get("page") {
+		case "":
+			etag, body, next = `"page-1"`, `[{"full_name":"my-org/repo-1"}]`, true
+		case "2":
+			name := repo2Name.Load().(string)
+			etag, body = fmt.Sprintf(`"page-2-%s"`, name), fmt.Sprintf(`[{"full_name":%q}]`, name)
+		}
+
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		fullResponses.Add(1)
+		w.Header().Set("ETag", etag)
+		if next {
+			w.Header().Set("Link", fmt.Sprintf(`<http://%s/orgs/my-org/repos?per_page=1&page=2>; rel="next"`, r.Host))
+		}
+		_, _ = w.Write([]byte(body))
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	client := NewHTTPClient(HTTPClientOptions{BaseURL: srv.URL})
+	cache := &ListingCache{Dir: t.TempDir()}
+	listOpts := ListRepositoriesOptions{PerPage: 1, AllPages: true, ListingCache: cache}
+
+	repoPages, err := client.ListOrganizationRepositories(ctx, "my-org", listOpts)
+	require.NoError(t, err)
+	require.Equal(t, [][]Repository{{{Name: "my-org/repo-1"}}, {{Name: "my-org/repo-2"}}}, repoPages)
+	require.Equal(t, int32(2), fullResponses.Load())
+
+	t.Run("unchanged pages are revalidated", func(t *testing.T) {
+		fullResponses.Store(0)
+
+		repoPages, err := client.ListOrganizationRepositories(ctx, "my-org", listOpts)
+		require.NoError(t, err)
+		require.Equal(t, [][]Repository{{{Name: "my-org/repo-1"}}, {{Name: "my-org/repo-2"}}}, repoPages)
+		require.Equal(t, int32(0), fullResponses.Load())
+	})
+
+	t.Run("changed pages are refreshed", func(t *testing.T) {
+		fullResponses.Store(0)
+		repo2Name.Store("my-org/repo-2-renamed")
+
+		repoPages, err := client.ListOrganizationRepositories(ctx, "my-org", listOpts)
+		require.NoError(t, err)
+		require.Equal(t, [][]Repository{{{Name: "my-org/repo-1"}}, {{Name: "my-org/repo-2-renamed"}}}, repoPages)
+		require.Equal(t, int32(1), fullResponses.Load())
+	})
+
+	t.Run("offline replays the last listing", func(t *testing.T) {
+		offlineClient := NewHTTPClient(HTTPClientOptions{BaseURL: srv.URL, HTTPClient: &http.Client{
+			Transport: roundTripperFunc(func(*http.Request) (*http.Response, error) {
+				return nil, fmt.Errorf("unexpected request")
+			}),
+		}})
+
+		repoPages, err := offlineClient.ListOrganizationRepositories(ctx, "my-org", ListRepositoriesOptions{
+			PerPage:      1,
+			AllPages:     true,
+			ListingCache: &ListingCache{Dir: cache.Dir, Offline: true},
+		})
+		require.NoError(t, err)
+		require.Equal(t, [][]Repository{{{Name: "my-org/repo-1"}}, {{Name: "my-org/repo-2-renamed"}}}, repoPages)
+	})
+
+	t.Run("offline does not replay listings of other identities", func(t *testing.T) {
+		otherClient := NewHTTPClient(HTTPClientOptions{BaseURL: srv.URL, Token: "other-token"})
+
+		_, err := otherClient.ListOrganizationRepositories(ctx, "my-org", ListRepositoriesOptions{
+			PerPage:      1,
+			AllPages:     true,
+			ListingCache: &ListingCache{Dir: cache.Dir, Offline: true},
+		})
+		require.ErrorIs(t, err, ErrListingNotCached)
+	})
+
+	t.Run("scope replaces the token identity", func(t *testing.T) {
+		scopedCache := &ListingCache{Dir: t.TempDir(), Scope: "my-app"}
+
+		_, err := NewHTTPClient(HTTPClientOptions{BaseURL: srv.URL, Token: "token-1"}).ListOrganizationRepositories(ctx, "my-org", ListRepositoriesOptions{ListingCache: scopedCache})
+		require.NoError(t, err)
+
+		// the rotated token lists under the same scope
+		_, err = NewHTTPClient(HTTPClientOptions{BaseURL: srv.URL, Token: "token-2"}).ListOrganizationRepositories(ctx, "my-org", ListRepositoriesOptions{
+			ListingCache: &ListingCache{Dir: scopedCache.Dir, Scope: "my-app", Offline: true},
+		})
+		require.NoError(t, err)
+	})
+
+	t.Run("identified token sources are scoped by identity", func(t *testing.T) {
+		identityCache := &ListingCache{Dir: t.TempDir()}
+
+		var tokens atomic.Int32
+		ts := identifiedTokenSource{
+			tokenSourceFunc: func(context.Context) (string, error) {
+				return fmt.Sprintf("token-%d", tokens.Add(1)), nil
+			},
+			identity: "app:1 installation:2",
+		}
+
+		_, err := NewHTTPClient(HTTPClientOptions{BaseURL: srv.URL, TokenSource: ts}).ListOrganizationRepositories(ctx, "my-org", ListRepositoriesOptions{ListingCache: identityCache})
+		require.NoError(t, err)
+		require.Equal(t, int32(1), tokens.Load())
+
+		// the listing is replayed without minting a token
+		_, err = NewHTTPClient(HTTPClientOptions{BaseURL: srv.URL, TokenSource: ts}).ListOrganizationRepositories(ctx, "my-org", ListRepositoriesOptions{
+			ListingCache: &ListingCache{Dir: identityCache.Dir, Offline: true},
+		})
+		require.NoError(t, err)
+		require.Equal(t, int32(1), tokens.Load())
+	})
+
+	t.Run("offline with scope does not resolve the token", func(t *testing.T) {
+		ts := tokenSourceFunc(func(context.Context) (string, error) {
+			return "", fmt.Errorf("unexpected token resolution")
+		})
+
+		_, err := NewHTTPClient(HTTPClientOptions{BaseURL: srv.URL, TokenSource: ts}).ListOrganizationRepositories(ctx, "my-org", ListRepositoriesOptions{
+			ListingCache: &ListingCache{Dir: t.TempDir(), Scope: "my-app", Offline: true},
+		})
+		require.ErrorIs(t, err, ErrListingNotCached)
+	})
+
+	t.Run("offline without cached listing", func(t *testing.T) {
+		_, err := client.ListOrganizationRepositories(ctx, "other-org", ListRepositoriesOptions{
+			ListingCache: &ListingCache{Dir: cache.Dir, Offline: true},
+		})
+		require.ErrorIs(t, err, ErrListingNotCached)
+	})
+}
+
+type identifiedTokenSource struct {
+	tokenSourceFunc
+	identity string
+}
+
+func (s identifiedTokenSource) Identity() string {
+	return s.identity
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
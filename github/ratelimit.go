@@ -0,0 +1,261 @@
+package github
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	iteratorexec "github.com/jcchavezs/gh-iterator/exec"
+	"github.com/jcchavezs/gh-iterator/internal/log"
+)
+
+const (
+	// rateLimitReserve is the number of remaining requests under which calls are paused until
+	// the rate limit resets.
+	rateLimitReserve = 10
+	// maxRateLimitRetries is the maximum number of retries for rate limited requests.
+	maxRateLimitRetries = 3
+	// secondaryRateLimitBackoff is the initial wait for secondary rate limits without Retry-After
+	// as GitHub recommends waiting at least one minute.
+	secondaryRateLimitBackoff = time.Minute
+)
+
+// rateLimiter tracks the rate limit budget from the API responses and pauses the calls when the
+// budget is about to be exhausted or the API asks to wait.
+type rateLimiter struct {
+	now   func() time.Time
+	sleep func(ctx context.Context, d time.Duration) error
+
+	mux        sync.Mutex
+	limit      int
+	remaining  int
+	reset      time.Time
+	pauseUntil time.Time
+}
+
+// newRateLimiter creates the rate limiter of a client. Limiters are not shared across clients as
+// every client can authenticate with a different identity hence have its own budget, the workers
+// of a run share the client through the context hence they pause together.
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{now: time.Now, sleep: sleepCtx, remaining: -1}
+}
+
+// RateLimit is the rate limit budget of the GitHub API as reported by the last response.
+type RateLimit struct {
+	// Limit is the maximum number of requests in the window.
+	Limit int
+	// Remaining is the number of requests left in the window.
+	Remaining int
+	// Reset is when the window resets.
+	Reset time.Time
+}
+
+// RateLimitReporter is implemented by the clients tracking the rate limit budget e.g. the ones
+// created by NewGHClient or NewHTTPClient.
+type RateLimitReporter interface {
+	// RateLimit returns the last known budget, false if no response reported it yet.
+	RateLimit() (RateLimit, bool)
+}
+
+// budget returns the last known budget.
+func (l *rateLimiter) budget() (RateLimit, bool) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	if l.remaining < 0 {
+		return RateLimit{}, false
+	}
+
+	return RateLimit{Limit: l.limit, Remaining: l.remaining, Reset: l.reset}, true
+}
+
+// wait blocks until the calls can be resumed.
+func (l *rateLimiter) wait(ctx context.Context) error {
+	l.mux.Lock()
+	now := l.now()
+	until := l.pauseUntil
+	if l.remaining >= 0 && l.remaining < rateLimitReserve && l.reset.After(until) {
+		until = l.reset
+	}
+	remaining := l.remaining
+	l.mux.Unlock()
+
+	if !until.After(now) {
+		return nil
+	}
+
+	log.FromCtx(ctx).Warn("Pausing GitHub API calls due to rate limit", "remaining", remaining, "resume_at", until)
+	return l.sleep(ctx, until.Sub(now))
+}
+
+// update records the rate limit budget from the response headers.
+func (l *rateLimiter) update(ctx context.Context, header http.Header) {
+	remaining, err := strconv.Atoi(header.Get("X-RateLimit-Remaining"))
+	if err != nil {
+		return
+	}
+
+	reset, err := strconv.ParseInt(header.Get("X-RateLimit-Reset"), 10, 64)
+	if err != nil {
+		return
+	}
+
+	// the limit is informative only hence a missing header is not an error
+	limit, _ := strconv.Atoi(header.Get("X-RateLimit-Limit"))
+
+	l.mux.Lock()
+	l.limit, l.remaining, l.reset = limit, remaining, time.Unix(reset, 0)
+	l.mux.Unlock()
+
+	log.FromCtx(ctx).Debug("GitHub API rate limit budget", "limit", limit, "remaining", remaining, "reset", time.Unix(reset, 0))
+}
+
+// backoff returns how long to wait before retrying a rate limited response and pauses the
+// calls until then. It returns false if the response is not rate limited.
+func (l *rateLimiter) backoff(res apiResponse, attempt int) (time.Duration, bool) {
+	if res.status != http.StatusForbidden && res.status != http.StatusTooManyRequests {
+		return 0, false
+	}
+
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	now := l.now()
+
+	var wait time.Duration
+	if retryAfter, err := strconv.Atoi(res.header.Get("Retry-After")); err == nil {
+		wait = time.Duration(retryAfter) * time.Second
+	} else if res.header.Get("X-RateLimit-Remaining") == "0" {
+		wait = max(l.reset.Sub(now), 0)
+	} else if res.status == http.StatusTooManyRequests || bytes.Contains(bytes.ToLower(res.body), []byte("rate limit")) {
+		wait = secondaryRateLimitBackoff << attempt
+	} else {
+		// forbidden for any other reason e.g. missing permissions
+		return 0, false
+	}
+
+	if until := now.Add(wait); until.After(l.pauseUntil) {
+		l.pauseUntil = until
+	}
+
+	return wait, true
+}
+
+// backoffStderr is backoff for the gh commands other than `gh api --include`, which only report
+// the rate limits in the stderr.
+func (l *rateLimiter) backoffStderr(stderr string, attempt int) (time.Duration, bool) {
+	lower := strings.ToLower(stderr)
+	if !strings.Contains(lower, "rate limit") && !strings.Contains(lower, "http 429") {
+		return 0, false
+	}
+
+	return l.backoff(apiResponse{status: http.StatusTooManyRequests, body: []byte(stderr)}, attempt)
+}
+
+// rateLimitedTransport pauses and retries the requests according to the rate limits.
+type rateLimitedTransport struct {
+	t       transport
+	limiter *rateLimiter
+}
+
+func (t rateLimitedTransport) withExecer(xr iteratorexec.Execer) transport {
+	if et, ok := t.t.(execerTransport); ok {
+		t.t = et.withExecer(xr)
+	}
+
+	return t
+}
+
+func (t rateLimitedTransport) identity() string {
+	return t.t.identity()
+}
+
+func (t rateLimitedTransport) authToken(ctx context.Context) (string, error) {
+	return t.t.authToken(ctx)
+}
+
+func (t rateLimitedTransport) do(ctx context.Context, req apiRequest) (apiResponse, error) {
+	for attempt := 0; ; attempt++ {
+		if err := t.limiter.wait(ctx); err != nil {
+			return apiResponse{}, err
+		}
+
+		res, err := t.t.do(ctx, req)
+		if err != nil {
+			return res, err
+		}
+
+		t.limiter.update(ctx, res.header)
+		if attempt == maxRateLimitRetries {
+			return res, nil
+		}
+
+		wait, limited := t.limiter.backoff(res, attempt)
+		if !limited {
+			return res, nil
+		}
+
+		log.FromCtx(ctx).Warn("GitHub API rate limit exceeded, retrying", "path", req.path, "status", res.status, "retry_in", wait, "attempt", attempt+1)
+	}
+}
+
+// runGH runs the gh command with xr.Run pausing and retrying it according to the rate limits of
+// the client in the context if any.
+func runGH(ctx context.Context, xr iteratorexec.Execer, args ...string) (iteratorexec.Result, error) {
+	return withGHRateLimit(ctx, args, func() (iteratorexec.Result, string, error) {
+		res, err := xr.Run(ctx, "gh", args...)
+		return res, res.Stderr, err
+	})
+}
+
+// runGHX is runGH with xr.RunX.
+func runGHX(ctx context.Context, xr iteratorexec.Execer, args ...string) (string, error) {
+	return withGHRateLimit(ctx, args, func() (string, string, error) {
+		out, err := xr.RunX(ctx, "gh", args...)
+		stderr, _ := iteratorexec.GetStderr(err)
+		return out, stderr, err
+	})
+}
+
+func withGHRateLimit[T any](ctx context.Context, args []string, run func() (T, string, error)) (T, error) {
+	limiter := limiterFromContext(ctx)
+	if limiter == nil {
+		out, _, err := run()
+		return out, err
+	}
+
+	for attempt := 0; ; attempt++ {
+		if err := limiter.wait(ctx); err != nil {
+			var zero T
+			return zero, err
+		}
+
+		out, stderr, err := run()
+		if attempt == maxRateLimitRetries {
+			return out, err
+		}
+
+		wait, limited := limiter.backoffStderr(stderr, attempt)
+		if !limited {
+			return out, err
+		}
+
+		log.FromCtx(ctx).Warn("GitHub API rate limit exceeded, retrying", "command", "gh "+strings.Join(args[:min(2, len(args))], " "), "retry_in", wait, "attempt", attempt+1)
+	}
+}
+
+func sleepCtx(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
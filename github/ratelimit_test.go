@@ -0,0 +1,272 @@
+package github
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	iteratorexec "github.com/jcchavezs/gh-iterator/exec"
+	"github.com/jcchavezs/gh-iterator/exec/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestRateLimitedClient(t *testing.T, handler http.HandlerFunc) (Client, *[]time.Duration) {
+	t.Helper()
+
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	var sleeps []time.Duration
+	now := time.Unix(1_700_000_000, 0)
+	limiter := newRateLimiter()
+	limiter.now = func() time.Time { return now }
+	limiter.sleep = func(_ context.Context, d time.Duration) error {
+		sleeps = append(sleeps, d)
+		now = now.Add(d)
+		return nil
+	}
+
+	return client{limiter: limiter, t: rateLimitedTransport{
+		t:       httpTransport{baseURL: srv.URL, httpClient: srv.Client()},
+		limiter: limiter,
+	}}, &sleeps
+}
+
+func TestRateLimitedTransport(t *testing.T) {
+	ctx := context.Background()
+	reset := strconv.FormatInt(time.Unix(1_700_000_000, 0).Add(30*time.Second).Unix(), 10)
+
+	t.Run("retries after Retry-After", func(t *testing.T) {
+		var calls atomic.Int32
+		c, sleeps := newTestRateLimitedClient(t, func(w http.ResponseWriter, r *http.Request) {
+			if calls.Add(1) == 1 {
+				w.Header().Set("Retry-After", "5")
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+
+			_, _ = w.Write([]byte(`{"full_name":"my-org/repo-1"}`))
+		})
+
+		repo, err := c.GetRepository(ctx, "my-org/repo-1")
+		require.NoError(t, err)
+		require.Equal(t, "my-org/repo-1", repo.Name)
+		require.Equal(t, int32(2), calls.Load())
+		require.Equal(t, []time.Duration{5 * time.Second}, *sleeps)
+	})
+
+	t.Run("retries after primary rate limit reset", func(t *testing.T) {
+		var calls atomic.Int32
+		c, sleeps := newTestRateLimitedClient(t, func(w http.ResponseWriter, r *http.Request) {
+			if calls.Add(1) == 1 {
+				w.Header().Set("X-RateLimit-Remaining", "0")
+				w.Header().Set("X-RateLimit-Reset", reset)
+				w.WriteHeader(http.StatusForbidden)
+				_, _ = w.Write([]byte(`{"message":"API rate limit exceeded"}`))
+				return
+			}
+
+			_, _ = w.Write([]byte(`{"full_name":"my-org/repo-1"}`))
+		})
+
+		_, err := c.GetRepository(ctx, "my-org/repo-1")
+		require.NoError(t, err)
+		require.Equal(t, int32(2), calls.Load())
+		require.Equal(t, []time.Duration{30 * time.Second}, *sleeps)
+	})
+
+	t.Run("retries secondary rate limit with backoff", func(t *testing.T) {
+		c, sleeps := newTestRateLimitedClient(t, func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`{"message":"You have exceeded a secondary rate limit"}`))
+		})
+
+		_, err := c.GetRepository(ctx, "my-org/repo-1")
+		require.ErrorContains(t, err, "secondary rate limit")
+		require.Equal(t, []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute}, *sleeps)
+	})
+
+	t.Run("does not retry forbidden", func(t *testing.T) {
+		var calls atomic.Int32
+		c, sleeps := newTestRateLimitedClient(t, func(w http.ResponseWriter, r *http.Request) {
+			calls.Add(1)
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`{"message":"Resource not accessible by integration"}`))
+		})
+
+		_, err := c.GetRepository(ctx, "my-org/repo-1")
+		require.ErrorContains(t, err, "resource not accessible by integration")
+		require.Equal(t, int32(1), calls.Load())
+		require.Empty(t, *sleeps)
+	})
+
+	t.Run("pauses when close to the limit", func(t *testing.T) {
+		c, sleeps := newTestRateLimitedClient(t, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-RateLimit-Remaining", "3")
+			w.Header().Set("X-RateLimit-Reset", reset)
+			_, _ = w.Write([]byte(`{"full_name":"my-org/repo-1"}`))
+		})
+
+		_, err := c.GetRepository(ctx, "my-org/repo-1")
+		require.NoError(t, err)
+		require.Empty(t, *sleeps)
+
+		_, err = c.GetRepository(ctx, "my-org/repo-1")
+		require.NoError(t, err)
+		require.Equal(t, []time.Duration{30 * time.Second}, *sleeps)
+	})
+}
+
+func TestRateLimit(t *testing.T) {
+	ctx := context.Background()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-RateLimit-Limit", "5000")
+		w.Header().Set("X-RateLimit-Remaining", "4999")
+		w.Header().Set("X-RateLimit-Reset", "1700000000")
+		_, _ = w.Write([]byte(`{"full_name":"my-org/repo-1"}`))
+	}))
+	t.Cleanup(srv.Close)
+
+	c := NewHTTPClient(HTTPClientOptions{BaseURL: srv.URL, HTTPClient: srv.Client()})
+	other := NewHTTPClient(HTTPClientOptions{BaseURL: srv.URL, HTTPClient: srv.Client()})
+
+	_, ok := c.(RateLimitReporter).RateLimit()
+	require.False(t, ok)
+
+	_, err := c.GetRepository(ctx, "my-org/repo-1")
+	require.NoError(t, err)
+
+	rl, ok := c.(RateLimitReporter).RateLimit()
+	require.True(t, ok)
+	require.Equal(t, RateLimit{Limit: 5000, Remaining: 4999, Reset: time.Unix(1_700_000_000, 0)}, rl)
+
+	// clients can authenticate with different identities hence they do not share the budget
+	_, ok = other.(RateLimitReporter).RateLimit()
+	require.False(t, ok)
+}
+
+func TestSharedRateLimit(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			w.Header().Set("Retry-After", "5")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+
+		_, _ = w.Write([]byte("file contents"))
+	}))
+	t.Cleanup(srv.Close)
+
+	var (
+		mux    sync.Mutex
+		sleeps []time.Duration
+		paused = make(chan struct{})
+		resume = make(chan struct{})
+	)
+
+	start := time.Unix(1_700_000_000, 0)
+	var elapsed atomic.Int64
+
+	limiter := newRateLimiter()
+	limiter.now = func() time.Time { return start.Add(time.Duration(elapsed.Load())) }
+	limiter.sleep = func(_ context.Context, d time.Duration) error {
+		mux.Lock()
+		sleeps = append(sleeps, d)
+		mux.Unlock()
+
+		paused <- struct{}{}
+		<-resume
+
+		// both workers pause until the same time
+		elapsed.Store(int64(d))
+		return nil
+	}
+
+	ctx := WithClient(context.Background(), client{limiter: limiter, t: rateLimitedTransport{
+		t:       httpTransport{baseURL: srv.URL, httpClient: srv.Client()},
+		limiter: limiter,
+	}})
+
+	var wg sync.WaitGroup
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		content, err := ReadFile(ctx, mock.Execer{}, "owner/repo", "file.txt")
+		require.NoError(t, err)
+		require.Equal(t, []byte("file contents"), content)
+	}()
+
+	// the first worker hits the rate limit
+	<-paused
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		xr := mock.Execer{
+			RunFn: func(ctx context.Context, command string, args ...string) (iteratorexec.Result, error) {
+				return iteratorexec.Result{ExitCode: 1}, nil
+			},
+			RunXFn: func(ctx context.Context, command string, args ...string) (string, error) {
+				if mock.CallIs(t, command, args, "gh", "pr", "create", "--fill") {
+					return "https://github.com/owner/repo/pull/1", nil
+				}
+
+				return "", mock.ErrUnexpectedCall
+			},
+			Logger: slog.New(slog.DiscardHandler),
+		}
+
+		_, _, err := CreatePRIfNotExist(ctx, xr, PROptions{})
+		require.NoError(t, err)
+	}()
+
+	// the second worker pauses before calling gh
+	<-paused
+
+	close(resume)
+	wg.Wait()
+
+	require.Equal(t, []time.Duration{5 * time.Second, 5 * time.Second}, sleeps)
+	require.Equal(t, int32(2), calls.Load())
+}
+
+func TestRunGH(t *testing.T) {
+	limiter := newRateLimiter()
+	limiter.now = func() time.Time { return time.Unix(1_700_000_000, 0) }
+
+	var sleeps []time.Duration
+	limiter.sleep = func(_ context.Context, d time.Duration) error {
+		sleeps = append(sleeps, d)
+		return nil
+	}
+
+	ctx := WithClient(context.Background(), client{limiter: limiter})
+
+	var calls int
+	xr := mock.Execer{
+		RunXFn: func(ctx context.Context, command string, args ...string) (string, error) {
+			if calls++; calls == 1 {
+				return "", iteratorexec.NewExecErr("gh repo fork: exit code 1", "HTTP 403: You have exceeded a secondary rate limit", 1)
+			}
+
+			return "ok", nil
+		},
+	}
+
+	out, err := runGHX(ctx, xr, "repo", "fork")
+	require.NoError(t, err)
+	require.Equal(t, "ok", out)
+	require.Equal(t, 2, calls)
+	require.Equal(t, []time.Duration{time.Minute}, sleeps)
+}
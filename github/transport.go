@@ -0,0 +1,267 @@
+package github
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	iteratorexec "github.com/jcchavezs/gh-iterator/exec"
+)
+
+// apiRequest is a request to the GitHub REST API.
+type apiRequest struct {
+	method string
+	// path is the API path including the query e.g. /orgs/my-org/repos?per_page=100
+	path   string
+	accept string
+	// cache is the duration to cache the response for, only supported by the gh CLI.
+	cache time.Duration
+	// ifNoneMatch is the ETag to make a conditional request.
+	ifNoneMatch string
+}
+
+// apiResponse is a response from the GitHub REST API.
+type apiResponse struct {
+	status int
+	header http.Header
+	body   []byte
+}
+
+// transport sends requests to the GitHub REST API.
+type transport interface {
+	do(ctx context.Context, req apiRequest) (apiResponse, error)
+	// authToken returns the token authenticating the requests, empty if they are anonymous.
+	authToken(ctx context.Context) (string, error)
+	// identity returns a stable identifier of who the requests authenticate as, empty if unknown.
+	identity() string
+}
+
+// execerTransport is implemented by the transports calling the API through an execer.
+type execerTransport interface {
+	// withExecer returns a copy of the transport calling through xr.
+	withExecer(xr iteratorexec.Execer) transport
+}
+
+// ghTransport sends requests through the gh CLI.
+type ghTransport struct {
+	xr iteratorexec.Execer
+	// host is the GitHub hostname, by default the one configured in gh.
+	host string
+}
+
+func (t ghTransport) withExecer(xr iteratorexec.Execer) transport {
+	t.xr = xr
+	return t
+}
+
+func (t ghTransport) do(ctx context.Context, req apiRequest) (apiResponse, error) {
+	target, err := apiPath(req.path)
+	if err != nil {
+		return apiResponse{}, fmt.Errorf("parsing path: %w", err)
+	}
+
+	args := []string{"api", "--include",
+		"-X", req.method,
+		"-H", "Accept: " + req.accept,
+		"-H", "X-GitHub-Api-Version: " + apiVersion,
+	}
+
+	if req.ifNoneMatch != "" {
+		args = append(args, "-H", "If-None-Match: "+req.ifNoneMatch)
+	}
+
+	if t.host != "" {
+		args = append(args, "--hostname", t.host)
+	}
+
+	if req.cache > 0 {
+		args = append(args, "--cache", req.cache.String())
+	}
+
+	// gh prints the response to stdout even when the status is not successful
+	out, err := t.xr.RunX(ctx, "gh", append(args, target)...)
+	if len(out) == 0 {
+		if err == nil {
+			err = fmt.Errorf("empty response from %s", target)
+		}
+
+		return apiResponse{}, err
+	}
+
+	res, pErr := parseGHResponse(out)
+	if pErr != nil {
+		if err != nil {
+			return apiResponse{}, err
+		}
+
+		return apiResponse{}, fmt.Errorf("parsing response: %w", pErr)
+	}
+
+	return res, nil
+}
+
+func (t ghTransport) identity() string {
+	return ""
+}
+
+func (t ghTransport) authToken(ctx context.Context) (string, error) {
+	args := []string{"auth", "token"}
+	if t.host != "" {
+		args = append(args, "--hostname", t.host)
+	}
+
+	token, err := iteratorexec.TrimStdout(t.xr.RunX(ctx, "gh", args...))
+	if err != nil {
+		return "", fmt.Errorf("getting gh token: %w", err)
+	}
+
+	return token, nil
+}
+
+// parseGHResponse parses the output of `gh api --include` i.e. the status line, the headers
+// and the body.
+func parseGHResponse(out string) (apiResponse, error) {
+	r := textproto.NewReader(bufio.NewReader(strings.NewReader(out)))
+
+	statusLine, err := r.ReadLine()
+	if err != nil {
+		return apiResponse{}, fmt.Errorf("reading status line: %w", err)
+	}
+
+	// e.g. HTTP/2.0 200 OK
+	_, statusAndText, _ := strings.Cut(statusLine, " ")
+	statusCode, _, _ := strings.Cut(statusAndText, " ")
+	status, err := strconv.Atoi(statusCode)
+	if err != nil {
+		return apiResponse{}, fmt.Errorf("parsing status line %q: %w", statusLine, err)
+	}
+
+	header, err := r.ReadMIMEHeader()
+	if err != nil && err != io.EOF {
+		return apiResponse{}, fmt.Errorf("reading headers: %w", err)
+	}
+
+	body, err := io.ReadAll(r.R)
+	if err != nil {
+		return apiResponse{}, fmt.Errorf("reading body: %w", err)
+	}
+
+	return apiResponse{status: status, header: http.Header(header), body: body}, nil
+}
+
+// apiPath returns the API path for absolute URLs returned by the API e.g. in the Link
+// header, as gh expects paths relative to the API root.
+func apiPath(target string) (string, error) {
+	if !isAbsoluteURL(target) {
+		return target, nil
+	}
+
+	u, err := url.Parse(target)
+	if err != nil {
+		return "", err
+	}
+
+	// GitHub Enterprise Server serves the API under /api/v3
+	p := strings.TrimPrefix(u.Path, "/api/v3")
+	if u.RawQuery != "" {
+		p += "?" + u.RawQuery
+	}
+
+	return p, nil
+}
+
+// httpTransport sends requests over HTTP.
+type httpTransport struct {
+	baseURL     string
+	httpClient  *http.Client
+	token       string
+	tokenSource TokenSource
+}
+
+func (t httpTransport) do(ctx context.Context, req apiRequest) (apiResponse, error) {
+	target := req.path
+	if !isAbsoluteURL(target) {
+		target = t.baseURL + target
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, req.method, target, nil)
+	if err != nil {
+		return apiResponse{}, fmt.Errorf("creating request: %w", err)
+	}
+
+	httpReq.Header.Set("Accept", req.accept)
+	httpReq.Header.Set("X-GitHub-Api-Version", apiVersion)
+	if req.ifNoneMatch != "" {
+		httpReq.Header.Set("If-None-Match", req.ifNoneMatch)
+	}
+
+	token, err := t.authToken(ctx)
+	if err != nil {
+		return apiResponse{}, err
+	}
+
+	if token != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	httpRes, err := t.httpClient.Do(httpReq)
+	if err != nil {
+		return apiResponse{}, err
+	}
+	defer httpRes.Body.Close() //nolint:errcheck
+
+	body, err := io.ReadAll(httpRes.Body)
+	if err != nil {
+		return apiResponse{}, fmt.Errorf("reading body: %w", err)
+	}
+
+	return apiResponse{status: httpRes.StatusCode, header: httpRes.Header, body: body}, nil
+}
+
+func (t httpTransport) identity() string {
+	if its, ok := t.tokenSource.(IdentifiedTokenSource); ok {
+		return its.Identity()
+	}
+
+	return ""
+}
+
+func (t httpTransport) authToken(ctx context.Context) (string, error) {
+	if t.tokenSource == nil {
+		return t.token, nil
+	}
+
+	token, err := t.tokenSource.Token(ctx)
+	if err != nil {
+		return "", fmt.Errorf("getting token: %w", err)
+	}
+
+	return token, nil
+}
+
+func isAbsoluteURL(target string) bool {
+	return strings.HasPrefix(target, "http://") || strings.HasPrefix(target, "https://")
+}
+
+// nextPageURL returns the URL of the next page from the Link header if any.
+func nextPageURL(header http.Header) string {
+	for _, link := range strings.Split(header.Get("Link"), ",") {
+		target, params, ok := strings.Cut(link, ";")
+		if !ok {
+			continue
+		}
+
+		if strings.Contains(params, `rel="next"`) {
+			return strings.Trim(strings.TrimSpace(target), "<>")
+		}
+	}
+
+	return ""
+}
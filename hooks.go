@@ -0,0 +1,93 @@
+package iterator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jcchavezs/gh-iterator/exec"
+)
+
+// Hooks are callbacks run around the cloning and the processing of every repository e.g. to
+// configure the git identity in every clone or to notify failures. Any of them can be nil. A
+// hook returning an error fails the repository, or skips it if the error matches ErrSkip.
+type Hooks struct {
+	// BeforeClone runs before cloning a non empty repository.
+	BeforeClone func(ctx context.Context, repo Repository) error
+	// AfterClone runs once the repository is checked out, with an execer in the clone directory.
+	// When Options.Branches is set, it runs for every branch checked out.
+	AfterClone func(ctx context.Context, repo Repository, exec exec.Execer) error
+	// BeforeProcess runs before the processor with the same execer.
+	BeforeProcess func(ctx context.Context, repo Repository, exec exec.Execer) error
+	// AfterProcess runs after the processor, even if it failed, with the same execer and the
+	// error returned by the processor if any.
+	AfterProcess func(ctx context.Context, repo Repository, exec exec.Execer, err error) error
+	// OnError runs once the repository failed, with its outcome.
+	OnError func(ctx context.Context, repo Repository, outcome RepositoryOutcome)
+	// OnProgress runs once every repository processed is over, with the progress of the run e.g.
+	// to collect the findings of RunForRepository. It can be called concurrently.
+	OnProgress func(ctx context.Context, progress Progress)
+}
+
+// beforeClone runs the BeforeClone hook if any.
+func (h Hooks) beforeClone(ctx context.Context, repo Repository) error {
+	if h.BeforeClone == nil {
+		return nil
+	}
+
+	if err := h.BeforeClone(ctx, repo); err != nil {
+		return fmt.Errorf("running before clone hook: %w", err)
+	}
+
+	return nil
+}
+
+// afterClone runs the AfterClone hook if any.
+func (h Hooks) afterClone(ctx context.Context, repo Repository, xr exec.Execer) error {
+	if h.AfterClone == nil {
+		return nil
+	}
+
+	if err := h.AfterClone(ctx, repo, xr); err != nil {
+		return fmt.Errorf("running after clone hook: %w", err)
+	}
+
+	return nil
+}
+
+// onError runs the OnError hook if any and the outcome is a failure.
+func (h Hooks) onError(ctx context.Context, repo Repository, outcome RepositoryOutcome) {
+	if h.OnError == nil || outcome.Status != OutcomeFailed {
+		return
+	}
+
+	h.OnError(ctx, repo, outcome)
+}
+
+// onProgress runs the OnProgress hook if any.
+func (h Hooks) onProgress(ctx context.Context, progress Progress) {
+	if h.OnProgress == nil {
+		return
+	}
+
+	h.OnProgress(ctx, progress)
+}
+
+// runProcessor runs the processor surrounded by the BeforeProcess and AfterProcess hooks.
+func runProcessor(ctx context.Context, repo Repository, processor Processor, isEmpty bool, xr exec.Execer, h Hooks) error {
+	if h.BeforeProcess != nil {
+		if err := h.BeforeProcess(ctx, repo, xr); err != nil {
+			return fmt.Errorf("running before process hook: %w", err)
+		}
+	}
+
+	err := processor(ctx, repo.Name, isEmpty, xr)
+
+	if h.AfterProcess != nil {
+		if hErr := h.AfterProcess(ctx, repo, xr, err); hErr != nil {
+			return errors.Join(err, fmt.Errorf("running after process hook: %w", hErr))
+		}
+	}
+
+	return err
+}
@@ -0,0 +1,152 @@
+package iterator
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jcchavezs/gh-iterator/exec"
+	"github.com/jcchavezs/gh-iterator/github"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHooks(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("run around cloning and processing", func(t *testing.T) {
+		repo := newTestRepository(t)
+
+		var calls []string
+		hooks := Hooks{
+			BeforeClone: func(ctx context.Context, r Repository) error {
+				calls = append(calls, "before clone")
+				return nil
+			},
+			AfterClone: func(ctx context.Context, r Repository, xr exec.Execer) error {
+				calls = append(calls, "after clone")
+				_, err := xr.RunX(ctx, "git", "config", "user.name", "gh-iterator")
+				return err
+			},
+			BeforeProcess: func(ctx context.Context, r Repository, xr exec.Execer) error {
+				calls = append(calls, "before process")
+				return nil
+			},
+			AfterProcess: func(ctx context.Context, r Repository, xr exec.Execer, err error) error {
+				calls = append(calls, "after process")
+				require.EqualError(t, err, "boom")
+				return nil
+			},
+		}
+
+		err := processRepository(ctx, repo, func(ctx context.Context, repository string, isEmpty bool, xr exec.Execer) error {
+			calls = append(calls, "process")
+
+			userName, err := exec.TrimStdout(xr.RunX(ctx, "git", "config", "user.name"))
+			requireNoErrorAndPrintStderr(t, err)
+			require.Equal(t, "gh-iterator", userName)
+
+			return errors.New("boom")
+		}, RunOptions{Hooks: hooks})
+		require.EqualError(t, err, "boom")
+		require.Equal(t, []string{"before clone", "after clone", "before process", "process", "after process"}, calls)
+	})
+
+	t.Run("empty repository is not cloned", func(t *testing.T) {
+		var calls []string
+		err := processRepository(ctx, Repository{Name: "org/empty"}, func(ctx context.Context, repository string, isEmpty bool, xr exec.Execer) error {
+			calls = append(calls, "process")
+			return nil
+		}, RunOptions{Hooks: Hooks{
+			BeforeClone: func(ctx context.Context, r Repository) error {
+				calls = append(calls, "before clone")
+				return nil
+			},
+			BeforeProcess: func(ctx context.Context, r Repository, xr exec.Execer) error {
+				calls = append(calls, "before process")
+				return nil
+			},
+		}})
+		require.NoError(t, err)
+		require.Equal(t, []string{"before process", "process"}, calls)
+	})
+
+	t.Run("hook errors fail or skip the repository", func(t *testing.T) {
+		repo := newTestRepository(t)
+		processor := func(ctx context.Context, repository string, isEmpty bool, xr exec.Execer) error {
+			t.Fatal("processor should not run")
+			return nil
+		}
+
+		err := processRepository(ctx, repo, processor, RunOptions{Hooks: Hooks{
+			BeforeClone: func(ctx context.Context, r Repository) error { return Skip("frozen") },
+		}})
+		reason, ok := SkipReason(err)
+		require.True(t, ok)
+		require.Equal(t, "frozen", reason)
+
+		err = processRepository(ctx, repo, processor, RunOptions{Hooks: Hooks{
+			AfterClone: func(ctx context.Context, r Repository, xr exec.Execer) error { return errors.New("no identity") },
+		}})
+		require.EqualError(t, err, "running after clone hook: no identity")
+	})
+
+	t.Run("on error receives the failed outcomes", func(t *testing.T) {
+		repoPages := [][]Repository{{{Name: "repo1"}, {Name: "repo2"}}}
+
+		var failed []RepositoryOutcome
+		_, err := runForReposConcurrently(ctx, repoPages, 1, processAll, func(ctx context.Context, repo Repository, processor Processor, opts RunOptions) error {
+			if repo.Name == "repo2" {
+				return errors.New("boom")
+			}
+			return nil
+		}, nil, RunOptions{Hooks: Hooks{
+			OnError: func(ctx context.Context, r Repository, outcome RepositoryOutcome) {
+				failed = append(failed, outcome)
+			},
+		}})
+		require.Error(t, err)
+		require.Len(t, failed, 1)
+		require.Equal(t, "repo2", failed[0].Repository)
+		require.EqualError(t, failed[0].Err, "boom")
+	})
+
+	t.Run("on progress reports the outcomes with the rate limit", func(t *testing.T) {
+		repoPages := [][]Repository{{{Name: "repo1"}, {Name: "repo2", Archived: true}, {Name: "repo3"}}}
+		skipArchived := func(repo Repository) string {
+			if repo.Archived {
+				return SkipReasonArchived
+			}
+			return ""
+		}
+
+		rl := github.RateLimit{Limit: 5000, Remaining: 4999, Reset: time.Unix(1700000000, 0)}
+		ctx := github.WithClient(ctx, rateLimitReporterClient{rl: rl})
+
+		var progress []Progress
+		_, err := runForReposConcurrently(ctx, repoPages, 1, skipArchived, func(ctx context.Context, repo Repository, processor Processor, opts RunOptions) error {
+			return nil
+		}, nil, RunOptions{Hooks: Hooks{
+			OnProgress: func(ctx context.Context, p Progress) {
+				progress = append(progress, p)
+			},
+		}})
+		require.NoError(t, err)
+		require.Len(t, progress, 2)
+		for _, p := range progress {
+			require.Equal(t, OutcomeProcessed, p.Outcome.Status)
+			require.Equal(t, 3, p.Total)
+			require.Equal(t, &rl, p.RateLimit)
+		}
+		require.Equal(t, 3, progress[1].Done)
+	})
+}
+
+type rateLimitReporterClient struct {
+	github.Client
+	rl github.RateLimit
+}
+
+func (c rateLimitReporterClient) RateLimit() (github.RateLimit, bool) {
+	return c.rl, true
+}
@@ -1,10 +1,8 @@
 package iterator
 
 import (
-	"bufio"
 	"context"
 	"crypto/md5"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"log/slog"
@@ -21,18 +19,7 @@ import (
 )
 
 // Repository represents a GitHub repository
-type Repository struct {
-	Name              string    `json:"full_name"`
-	URL               string    `json:"clone_url"`
-	SSHURL            string    `json:"ssh_url"`
-	DefaultBranchName string    `json:"default_branch"`
-	Archived          bool      `json:"archived"`
-	Language          string    `json:"language"`
-	Visibility        string    `json:"visibility"`
-	Fork              bool      `json:"fork"`
-	Size              int       `json:"size"`
-	PushedAt          time.Time `json:"pushed_at"`
-}
+type Repository = github.Repository
 
 var (
 	baseDir  string
@@ -52,8 +39,44 @@ func init() {
 // - repository is the name of the repository.
 // - isEmpty is a flag to indicate if the repository is empty i.e. no branches nor commits.
 // - exec is an exec.Execer to run commands in the repository directory.
+// Returning an error matching ErrSkip e.g. Skip("no go.mod") skips the repository instead of
+// failing the run.
 type Processor func(ctx context.Context, repository string, isEmpty bool, exec exec.Execer) error
 
+type repositoryInfoKey struct{}
+
+// RepositoryInfo holds the repository being processed.
+type RepositoryInfo struct {
+	// Repository is the metadata of the repository as returned by the API.
+	Repository Repository
+	// Dir is the directory where the repository is checked out, empty if the repository
+	// is not cloned e.g. it is empty or it is listed by ListForOrganization.
+	Dir string
+	// HeadSHA is the SHA of the checked out commit, empty if the repository is not cloned.
+	HeadSHA string
+}
+
+// RepositoryFromContext returns the repository being processed, available in the context passed
+// to the processor.
+func RepositoryFromContext(ctx context.Context) (RepositoryInfo, bool) {
+	info, ok := ctx.Value(repositoryInfoKey{}).(RepositoryInfo)
+	return info, ok
+}
+
+func withRepositoryInfo(ctx context.Context, info RepositoryInfo) context.Context {
+	return context.WithValue(ctx, repositoryInfoKey{}, info)
+}
+
+// withCheckedOutRepositoryInfo returns a context with the repository checked out in dir.
+func withCheckedOutRepositoryInfo(ctx context.Context, repo Repository, dir string) (context.Context, error) {
+	sha, err := exec.TrimStdout(exec.NewExecerWithLogger(dir, log.FromCtx(ctx)).RunX(ctx, "git", "rev-parse", "HEAD"))
+	if err != nil {
+		return nil, fmt.Errorf("resolving HEAD: %w", err)
+	}
+
+	return withRepositoryInfo(ctx, RepositoryInfo{Repository: repo, Dir: dir, HeadSHA: sha}), nil
+}
+
 // CloneCacheKey is a function to generate a cache key for a repository clone.
 type CloneCacheKey func(repository Repository) string
 
@@ -68,11 +91,28 @@ type RunOptions = Options
 type Options struct {
 	// UseHTTPS is a flag to use HTTPS instead of SSH to clone the repositories.
 	UseHTTPS bool
+	// AutoProtocol makes the cloneability check to fall back to the other protocol (SSH if UseHTTPS
+	// is set, HTTPS otherwise) when the preferred one does not work, using the one that works to
+	// clone the repositories.
+	AutoProtocol bool
+	// SkipCloneabilityCheck skips checking that repositories can be cloned before processing them.
+	SkipCloneabilityCheck bool
+	// CloneabilityCheckCandidates is the maximum number of repositories to try when checking
+	// that repositories can be cloned, by default it tries 3.
+	CloneabilityCheckCandidates int
+	// CloneURL is a function that returns the URL to clone a repository from e.g. a local
+	// mirror (file://) or a caching proxy. If nil or if it returns an empty string, the SSH
+	// or HTTPS URL of the repository is used according to UseHTTPS.
+	CloneURL func(Repository) string
 	// CloneCacheKey is a key to identify the cached version of a repository clone to be used
 	// in an execution. This is beneficial when during the same execution a repository is cloned
 	// many times reducing the execution time by cloning once and copying the same repository locally.
 	// If the key is empty, no cache will be used.
 	CloneCacheKey CloneCacheKey
+	// CacheCopyStrategy is the strategy used to duplicate the cached clone for every use, by
+	// default it copies the whole directory. Other strategies fall back to a plain copy when they
+	// are not supported.
+	CacheCopyStrategy CacheCopyStrategy
 	// CloningSubset is a list of files or directories to clone to avoid cloning the whole repository.
 	// it is helpful on big repositories to speed up the process.
 	CloningSubset []string
@@ -84,8 +124,63 @@ type Options struct {
 	Debug bool
 	// Log handler
 	LogHandler slog.Handler
+	// Auth is the authentication used by all the gh and git commands, including the ones run by
+	// the processor. If nil, the ambient gh and git authentication is used.
+	Auth *Auth
+	// Client is the GitHub API client used to fetch the repositories e.g. github.NewHTTPClient to
+	// not depend on the gh CLI. If nil, the gh CLI is used with Auth and Host. The client is in the
+	// context of the processor (see github.ClientFromContext) hence the github helpers share its
+	// rate limit budget across the workers. github.CreatePRIfNotExist and github.ForkAndAddRemote
+	// still require the gh CLI.
+	Client github.Client
+	// Host is the GitHub hostname e.g. a GitHub Enterprise Server instance, by default the host
+	// configured in gh. It is passed to the gh API calls and set as GH_HOST in the execers passed
+	// to the processor so gh commands run by it e.g. github.CreatePRIfNotExist target the same host.
+	Host string
 	// ContextEnricher is a function to enrich the context before processing a repository.
 	ContextEnricher func(context.Context, Repository) context.Context
+	// Ref is a function that returns the git ref (branch, tag or commit SHA) to check out for a
+	// repository. If nil or if it returns an empty string, the default branch is checked out.
+	// Repositories where the ref does not exist are skipped and refs starting with "-" are
+	// rejected as git would parse them as options.
+	Ref func(Repository) string
+	// Branches is a list of patterns (as in path.Match e.g. "release-*") matching the branches to
+	// process in every repository. When set, the processor is invoked once per matching branch
+	// using git worktrees from a single clone, and Ref and CloneCacheKey are ignored. The branch
+	// being processed is available through BranchFromContext. Repositories without matching
+	// branches are skipped. Use CollectBranches rather than Collect to collect values per branch.
+	Branches []string
+	// Submodules is the mode to check out the git submodules, by default they are not checked out.
+	Submodules SubmodulesMode
+	// LFS is the mode to fetch the Git LFS objects, by default they are not fetched and LFS tracked
+	// files are left as pointers. Pulling LFS objects requires git-lfs to be installed.
+	LFS LFSMode
+	// Retry is the policy to retry fetching the repositories from the API and cloning them when
+	// they fail due to transient errors. If nil, nothing is retried.
+	Retry *RetryOptions
+	// Hooks are callbacks run around the cloning and the processing of every repository.
+	Hooks Hooks
+	// Middlewares wrap the processor e.g. RecoverMiddleware or TimeoutMiddleware, the first one
+	// being the outermost.
+	Middlewares []Middleware
+	// ErrorPolicy decides whether the run continues when a repository fails, including when the
+	// processor panics, by default FailFast.
+	ErrorPolicy ErrorPolicy
+	// RepoTimeout bounds the cloning and processing of every repository. The commands still running
+	// are killed once it is exceeded and the repository fails with ErrRepoTimeout.
+	RepoTimeout time.Duration
+	// TimeBudget is the time since the run starts, including fetching the repositories, after
+	// which no more repositories are scheduled. The repositories in flight finish, the rest are
+	// marked as OutcomeUnscheduled and the run returns the partial result with
+	// ErrTimeBudgetExceeded.
+	TimeBudget time.Duration
+	// MaxFailures aborts the run with ErrCircuitBreakerTripped after that many consecutive
+	// failures when ErrorPolicy is ContinueOnError e.g. because of broken credentials.
+	MaxFailures int
+	// FailureRate aborts the run with ErrCircuitBreakerTripped when the rate of failures over a
+	// window of the last repositories processed reaches a threshold, when ErrorPolicy is
+	// ContinueOnError.
+	FailureRate *FailureRateOptions
 }
 
 const (
@@ -93,30 +188,6 @@ const (
 	GithubAPIVersion       = "2022-11-28"
 )
 
-// processRepoPages processes the repository pages returned by the GitHub API and returns a slice of repositories.
-func processRepoPages(payload string) ([][]Repository, error) {
-	ls := bufio.NewScanner(strings.NewReader(payload))
-	ls.Split(bufio.ScanLines)
-	var repoPages [][]Repository
-	for ls.Scan() {
-		if len(ls.Bytes()) <= 2 {
-			break
-		}
-
-		var page = []Repository{}
-		if err := json.Unmarshal(ls.Bytes(), &page); err != nil {
-			return nil, fmt.Errorf("unmarshaling repositories: %w", err)
-		}
-		repoPages = append(repoPages, page)
-	}
-
-	if err := ls.Err(); err != nil {
-		return nil, fmt.Errorf("scaning reponse pages: %w", err)
-	}
-
-	return repoPages, nil
-}
-
 // Result holds the result from running the iterator for an organization.
 type Result struct {
 	// Found is the total number of repositories found i.e. the total number of
@@ -124,23 +195,57 @@ type Result struct {
 	Found int
 	// Inspected is the total number of repositories inspected before the filtering.
 	Inspected int
-	// Processed is the total number of repositories processed after the filtering.
+	// Processed is the total number of repositories processed after the filtering, successfully
+	// or not. Repositories skipped while processing e.g. by the processor returning ErrSkip are
+	// counted in Skipped instead.
 	Processed int
+	// Skipped is the total number of repositories skipped, either left out by the filtering or
+	// by the processor returning ErrSkip.
+	Skipped int
+	// SkipReasons is the number of repositories skipped by reason.
+	SkipReasons map[string]int
+	// Unscheduled is the total number of repositories not scheduled because the run exceeded
+	// Options.TimeBudget.
+	Unscheduled int
+	// Outcomes are the outcomes of the repositories inspected, in no particular order.
+	Outcomes []RepositoryOutcome
 }
 
 // RunForOrganization runs the processor for all repositories in an organization.
 func RunForOrganization(ctx context.Context, orgName string, searchOpts SearchOptions, processor Processor, opts RunOptions) (Result, error) {
 	defer os.RemoveAll(reposDir) //nolint:errcheck
 
+	ctx, stopBudget := withTimeBudget(ctx, opts.TimeBudget)
+	defer stopBudget()
+
 	ctx, logger := setupLogger(ctx, opts.LogHandler, opts.Debug)
 
-	repoPages, err := getRepoPages(ctx, searchOpts, orgName, logger)
+	auth, err := opts.Auth.resolve(ctx)
+	if err != nil {
+		return Result{}, err
+	}
+
+	// the token is resolved again for every repository hence opts keeps the token source
+	checkOpts := opts
+	checkOpts.Auth = auth
+
+	client := apiClient(opts.Client, logger, auth, opts.Host)
+	ctx = github.WithClient(ctx, client)
+
+	if opts.Client == nil {
+		searchOpts.ListingCache = opts.Auth.scopeListingCache(searchOpts.ListingCache)
+	}
+
+	repoPages, err := getRepoPages(ctx, searchOpts, orgName, client, opts.Retry)
 	if err != nil {
 		return Result{}, err
 	}
 
+	skipReason := searchOpts.makeSkipReason()
 	filterIn := searchOpts.MakeFilterIn()
-	if err := checkCloneability(ctx, repoPages, filterIn, opts.UseHTTPS); err != nil {
+	if opts.SkipCloneabilityCheck {
+		logger.Debug("Skipping cloneability check")
+	} else if opts.UseHTTPS, err = selectCloneProtocol(ctx, repoPages, filterIn, checkOpts); err != nil {
 		return Result{Found: countRepoPages(repoPages)}, err
 	}
 
@@ -149,48 +254,54 @@ func RunForOrganization(ctx context.Context, orgName string, searchOpts SearchOp
 		nOfWorkers = opts.NumberOfWorkers
 	}
 
-	return runForReposConcurrently(ctx, repoPages, nOfWorkers, filterIn, processRepository, processor, opts)
+	return runForReposConcurrently(ctx, repoPages, nOfWorkers, skipReason, processRepository, chainMiddlewares(processor, opts.Middlewares), opts)
 }
 
-func getRepoPages(ctx context.Context, searchOpts SearchOptions, orgName string, logger *slog.Logger) ([][]Repository, error) {
-	ghArgs := []string{"api",
-		"-H", "Accept: application/vnd.github+json",
-		"-H", "X-GitHub-Api-Version: " + GithubAPIVersion,
-		"-X", "GET",
-		"--jq", ". | map({full_name,clone_url,ssh_url,default_branch,archived,language,visibility,fork,size,pushed_at})",
+// apiClient returns the client or the gh CLI client with the authentication for the host if nil.
+func apiClient(client github.Client, logger *slog.Logger, auth *Auth, host string) github.Client {
+	if client != nil {
+		return client
 	}
 
-	if searchOpts.Cache > 0 {
-		ghArgs = append(ghArgs, "--cache", searchOpts.Cache.String())
+	return github.NewGHClientForHost(withAuth(exec.NewExecerWithLogger(".", logger), auth, host), host)
+}
+
+// withHost returns a child execer targeting the host with the gh commands if any.
+func withHost(xr exec.Execer, host string) exec.Execer {
+	if host != "" {
+		return xr.WithEnv("GH_HOST", host)
 	}
 
-	target := fmt.Sprintf("/orgs/%s/repos", orgName)
+	return xr
+}
+
+func getRepoPages(ctx context.Context, searchOpts SearchOptions, orgName string, client github.Client, retryOpts *RetryOptions) ([][]Repository, error) {
+	listOpts := github.ListRepositoriesOptions{Cache: searchOpts.Cache, ListingCache: searchOpts.ListingCache}
+
 	if searchOpts.PerPage == 0 || searchOpts.PerPage > maxPerPage {
-		target = fmt.Sprintf("%s?per_page=%d", target, defaultPerPage)
+		listOpts.PerPage = defaultPerPage
 	} else if searchOpts.PerPage > 0 {
-		target = fmt.Sprintf("%s?per_page=%d", target, searchOpts.PerPage)
+		listOpts.PerPage = searchOpts.PerPage
 	} else {
 		return nil, errors.New("invalid negative SearchOptions.PerPage")
 	}
 
 	if searchOpts.Page == AllPages {
-		ghArgs = append(ghArgs, "--paginate")
+		listOpts.AllPages = true
 	} else if searchOpts.Page > 0 {
-		target = fmt.Sprintf("%s&page=%d", target, searchOpts.Page)
+		listOpts.Page = int(searchOpts.Page)
 	} else if searchOpts.Page != 0 {
 		return nil, errors.New("invalid negative SearchOptions.Page")
 	}
 
-	xr := exec.NewExecerWithLogger(".", logger)
-	res, err := xr.RunX(ctx, "gh", append(ghArgs, target)...)
-	if err != nil {
-		return nil, fmt.Errorf("fetching repositories: %w", github.ErrOrGHAPIErr(res, err))
-	}
-
 	// TODO: handle this over a channel to boost speed on processing.
-	repoPages, err := processRepoPages(res)
+	var repoPages [][]Repository
+	err := retry(ctx, retryOpts, "fetching repositories", func() (err error) {
+		repoPages, err = client.ListOrganizationRepositories(ctx, orgName, listOpts)
+		return err
+	})
 	if err != nil {
-		return nil, fmt.Errorf("processing repositories pages: %w", err)
+		return nil, fmt.Errorf("fetching repositories: %w", err)
 	}
 
 	return repoPages, nil
@@ -209,18 +320,18 @@ func setupLogger(ctx context.Context, logHandler slog.Handler, debug bool) (cont
 	return log.NewCtx(ctx, logger), logger
 }
 
-const maxCloneabilityChecks = 3
+const defaultCloneabilityChecks = 3
 
-// selectCloneabilityCheckCandidates selects at most `maxCloneabilityChecks` repositories that pass the filter to check their cloneability.
-func selectCloneabilityCheckCandidates(repoPages [][]Repository, filterIn func(Repository) bool) []Repository {
-	var repos = make([]Repository, 0, maxCloneabilityChecks)
+// selectCloneabilityCheckCandidates selects at most n repositories that pass the filter to check their cloneability.
+func selectCloneabilityCheckCandidates(repoPages [][]Repository, filterIn func(Repository) bool, n int) []Repository {
+	var repos = make([]Repository, 0, n)
 
 	for _, rp := range repoPages {
 		for _, r := range rp {
 			if filterIn(r) && r.Name != "" {
 				repos = append(repos, r)
 
-				if len(repos) == maxCloneabilityChecks {
+				if len(repos) == n {
 					return repos
 				}
 			}
@@ -230,28 +341,28 @@ func selectCloneabilityCheckCandidates(repoPages [][]Repository, filterIn func(R
 	return repos
 }
 
-// checkCloneability tries to clone at most `maxCloneabilityChecks` repositories to ensure
+// checkCloneability tries to clone at most `CloneabilityCheckCandidates` repositories to ensure
 // that the authentication method works correctly.
-func checkCloneability(ctx context.Context, repoPages [][]Repository, filterIn func(Repository) bool, useHTTPS bool) error {
-	repos := selectCloneabilityCheckCandidates(repoPages, filterIn)
+func checkCloneability(ctx context.Context, repoPages [][]Repository, filterIn func(Repository) bool, opts RunOptions) error {
+	nOfCandidates := defaultCloneabilityChecks
+	if opts.CloneabilityCheckCandidates > 0 {
+		nOfCandidates = opts.CloneabilityCheckCandidates
+	}
+
+	repos := selectCloneabilityCheckCandidates(repoPages, filterIn, nOfCandidates)
 
 	if len(repos) == 0 {
 		return errors.New("no repositories to check cloneability")
 	}
 
 	logger := log.FromCtx(ctx)
-	xr := newExecerWithLogger(".", logger)
+	xr := withAuth(newExecerWithLogger(".", logger), opts.Auth, opts.Host)
 
 	var errs []error
 	for _, repo := range repos {
 		logger.Debug("Checking repository cloneability", "repository", repo.Name)
 
-		repoURL := repo.SSHURL
-		if useHTTPS {
-			repoURL = repo.URL
-		}
-
-		_, err := xr.RunX(ctx, "git", "ls-remote", "--exit-code", repoURL)
+		_, err := xr.RunX(ctx, "git", "ls-remote", "--exit-code", cloneURL(repo, opts))
 		if err == nil {
 			if len(errs) > 0 {
 				logger.Debug("Cloneability check passed after previous failures", "error", errors.Join(errs...))
@@ -268,6 +379,56 @@ func checkCloneability(ctx context.Context, repoPages [][]Repository, filterIn f
 
 var newExecerWithLogger = exec.NewExecerWithLogger
 
+// selectCloneProtocol checks the cloneability of the repositories and returns whether HTTPS
+// should be used to clone them. When AutoProtocol is enabled and the preferred protocol does
+// not work, the other protocol is checked.
+func selectCloneProtocol(ctx context.Context, repoPages [][]Repository, filterIn func(Repository) bool, opts RunOptions) (bool, error) {
+	err := checkCloneability(ctx, repoPages, filterIn, opts)
+	if !opts.AutoProtocol {
+		return opts.UseHTTPS, err
+	}
+
+	logger := log.FromCtx(ctx)
+	if err == nil {
+		logger.Info("Selected protocol to clone repositories", "protocol", protocolName(opts.UseHTTPS))
+		return opts.UseHTTPS, nil
+	}
+
+	fallbackOpts := opts
+	fallbackOpts.UseHTTPS = !opts.UseHTTPS
+
+	logger.Debug("Cloneability check failed, checking fallback protocol", "protocol", protocolName(fallbackOpts.UseHTTPS), "error", err)
+	if fErr := checkCloneability(ctx, repoPages, filterIn, fallbackOpts); fErr != nil {
+		return opts.UseHTTPS, errors.Join(err, fErr)
+	}
+
+	logger.Info("Selected fallback protocol to clone repositories", "protocol", protocolName(fallbackOpts.UseHTTPS))
+	return fallbackOpts.UseHTTPS, nil
+}
+
+func protocolName(useHTTPS bool) string {
+	if useHTTPS {
+		return "https"
+	}
+
+	return "ssh"
+}
+
+// cloneURL returns the URL to clone the repository from.
+func cloneURL(repo Repository, opts RunOptions) string {
+	if opts.CloneURL != nil {
+		if u := opts.CloneURL(repo); u != "" {
+			return u
+		}
+	}
+
+	if opts.UseHTTPS {
+		return repo.URL
+	}
+
+	return repo.SSHURL
+}
+
 // countRepoPages counts the total number of repositories in the pages.
 func countRepoPages(repoPages [][]Repository) int {
 	var mFound int
@@ -282,7 +443,7 @@ func runForReposConcurrently(
 	ctx context.Context,
 	repoPages [][]Repository,
 	nOfWorkers int,
-	filterIn func(Repository) bool,
+	skipReason func(Repository) string,
 	processorCaller func(context.Context, Repository, Processor, RunOptions) error,
 	processor Processor,
 	opts RunOptions,
@@ -290,6 +451,9 @@ func runForReposConcurrently(
 	var (
 		mFound                 = countRepoPages(repoPages)
 		mInspected, mProcessed int
+		outcomes               []RepositoryOutcome
+		failures               []error
+		breaker                = newCircuitBreaker(opts.MaxFailures, opts.FailureRate)
 	)
 
 	if mFound == 0 {
@@ -305,6 +469,33 @@ func runForReposConcurrently(
 		logger = log.FromCtx(ctx)
 	)
 
+	// done closes doneC once, either when all the repositories are scheduled or on failure.
+	done := sync.OnceFunc(func() { close(doneC) })
+
+	// result returns the result so far, including the outcomes of the repositories processed
+	// before a failure.
+	result := func() Result {
+		mMux.Lock()
+		defer mMux.Unlock()
+
+		res := Result{Found: mFound, Inspected: mInspected, Processed: mProcessed, Outcomes: outcomes}
+		for _, o := range outcomes {
+			switch o.Status {
+			case OutcomeSkipped:
+				if res.SkipReasons == nil {
+					res.SkipReasons = map[string]int{}
+				}
+
+				res.Skipped++
+				res.SkipReasons[o.SkipReason]++
+			case OutcomeUnscheduled:
+				res.Unscheduled++
+			}
+		}
+
+		return res
+	}
+
 	for range nOfWorkers {
 		wg.Add(1)
 		go func() {
@@ -315,13 +506,69 @@ func runForReposConcurrently(
 					// if the context is cancelled we do not process any more repositories
 					continue
 				default:
-					if err := processorCaller(ctx, repo, processor, opts); err != nil {
-						if errors.Is(err, errNoDefaultBranch) {
-							logger.Warn("Repository with no default branch", "repository", repo.Name)
+					stats := &repoStats{}
+					startedAt := time.Now()
+					repoCtx, cancel := withRepoTimeout(context.WithValue(ctx, repoStatsKey{}, stats), opts.RepoTimeout)
+					err := callRecovering(func() error {
+						return processorCaller(repoCtx, repo, processor, opts)
+					})
+					err = repoTimeoutErr(ctx, repoCtx, opts.RepoTimeout, err)
+					cancel()
+
+					var panicErr *PanicError
+					if errors.As(err, &panicErr) {
+						logger.Error("Processor panicked", "repository", repo.Name, "panic", panicErr.Value, "stack", string(panicErr.Stack))
+					}
+
+					outcome := newRepositoryOutcome(repo, err, time.Since(startedAt), stats)
+					opts.Hooks.onError(ctx, repo, outcome)
+
+					mMux.Lock()
+					outcomes = append(outcomes, outcome)
+					if outcome.Status == OutcomeSkipped {
+						// skipped while processing hence it is counted as skipped only
+						mProcessed--
+					}
+					nOfDone := len(outcomes)
+					mMux.Unlock()
+
+					opts.Hooks.onProgress(ctx, Progress{
+						Outcome:   outcome,
+						Done:      nOfDone,
+						Total:     mFound,
+						RateLimit: rateLimitFromContext(ctx),
+					})
+
+					if err != nil {
+						if reason, ok := SkipReason(err); ok {
+							logger.Warn("Repository skipped", "repository", repo.Name, "reason", reason, "error", err)
 							continue
 						}
 
-						errC <- fmt.Errorf("processing %q: %w", repo.Name, err)
+						err = fmt.Errorf("processing %q: %w", repo.Name, err)
+						if opts.ErrorPolicy != ContinueOnError {
+							errC <- err
+							return
+						}
+
+						logger.Error("Failed to process repository", "repository", repo.Name, "error", err)
+					}
+
+					mMux.Lock()
+					if err != nil {
+						failures = append(failures, err)
+					}
+
+					tripErr := breaker.record(err != nil)
+					if tripErr != nil {
+						// the failures collected so far are returned along with the reason to abort
+						tripErr = errors.Join(append([]error{tripErr}, failures...)...)
+					}
+					mMux.Unlock()
+
+					if tripErr != nil {
+						logger.Error("Aborting the run", "error", tripErr)
+						errC <- tripErr
 						return
 					}
 				}
@@ -329,94 +576,167 @@ func runForReposConcurrently(
 		}()
 	}
 
+	budgetExceededC := timeBudgetExceeded(ctx)
+
+	// unschedule records the repository as not scheduled once the time budget is exceeded.
+	unschedule := func(repo Repository) {
+		mMux.Lock()
+		defer mMux.Unlock()
+
+		mProcessed--
+		outcomes = append(outcomes, RepositoryOutcome{Repository: repo.Name, Status: OutcomeUnscheduled})
+	}
+
 	go func() {
 		defer close(repoC)
 		for _, repoPage := range repoPages {
 			for _, repo := range repoPage {
 				mMux.Lock()
 				mInspected++
-				if !filterIn(repo) {
+				if reason := skipReason(repo); reason != "" {
+					outcomes = append(outcomes, RepositoryOutcome{
+						Repository: repo.Name,
+						Status:     OutcomeSkipped,
+						SkipReason: reason,
+					})
 					mMux.Unlock()
 					continue
 				}
 				mProcessed++
 				mMux.Unlock()
 
+				// the budget takes precedence over workers ready to take more repositories
+				select {
+				case <-budgetExceededC:
+					unschedule(repo)
+					continue
+				default:
+				}
+
+				// sending within the select stops the scheduling once the run is done e.g. because a
+				// worker failed, instead of blocking forever on the channel nobody reads anymore
 				select {
 				case <-ctx.Done():
 					return
 				case <-doneC:
 					return
-				default:
-					repoC <- repo
+				case <-budgetExceededC:
+					unschedule(repo)
+				case repoC <- repo:
 				}
 			}
 		}
-		close(doneC)
+		done()
 	}()
 
 	for {
 		select {
 		case err, ok := <-errC:
 			if ok {
-				close(doneC)
+				done()
 				wg.Wait()
 				close(errC)
-				return Result{}, err
+				return result(), err
 			}
 		case <-ctx.Done():
 			wg.Wait()
-			select {
-			case <-doneC:
-			default:
-				close(doneC)
-			}
+			done()
 			close(errC)
-			return Result{}, ctx.Err()
+			return result(), ctx.Err()
 		case <-doneC:
 			wg.Wait()
 			defer close(errC)
 
 			select {
 			case err := <-errC:
-				return Result{}, err
+				return result(), err
 			default:
-				return Result{mFound, mInspected, mProcessed}, nil
+				// the context can be cancelled while the last repositories are processed
+				if err := ctx.Err(); err != nil {
+					return result(), err
+				}
+
+				res := result()
+
+				mMux.Lock()
+				errs := failures
+				mMux.Unlock()
+
+				if res.Unscheduled > 0 {
+					logger.Warn("Time budget exceeded", "time_budget", opts.TimeBudget, "unscheduled", res.Unscheduled)
+					errs = append(errs, fmt.Errorf("%w: %d repositories not scheduled", ErrTimeBudgetExceeded, res.Unscheduled))
+				}
+
+				return res, errors.Join(errs...)
 			}
 		}
 	}
 }
 
-// RunForRepository runs the processor for a single repository.
+// RunForRepository runs the processor for a single repository. Its outcome, including the
+// attached values and the findings, is passed to Hooks.OnProgress.
 func RunForRepository(ctx context.Context, repoName string, processor Processor, opts RunOptions) error {
 	if strings.Count(repoName, "/") > 1 {
 		return fmt.Errorf("incorrect repository name %q", repoName)
 	}
 
-	ctx, logger := setupLogger(ctx, opts.LogHandler, opts.Debug)
+	ctx, stopBudget := withTimeBudget(ctx, opts.TimeBudget)
+	defer stopBudget()
 
-	x := exec.NewExecerWithLogger(".", logger)
+	ctx, logger := setupLogger(ctx, opts.LogHandler, opts.Debug)
 
-	ghArgs := []string{"api",
-		"-H", "Accept: application/vnd.github+json",
-		"-H", "X-GitHub-Api-Version: " + GithubAPIVersion,
-		"-X", "GET",
-		"--jq", "{full_name,clone_url,ssh_url,default_branch,archived,language,visibility,fork,size,pushed_at}",
-		fmt.Sprintf("/repos/%s", repoName),
+	auth, err := opts.Auth.resolve(ctx)
+	if err != nil {
+		return err
 	}
 
-	res, err := x.RunX(ctx, "gh", ghArgs...)
+	checkOpts := opts
+	checkOpts.Auth = auth
+
+	client := apiClient(opts.Client, logger, auth, opts.Host)
+	ctx = github.WithClient(ctx, client)
+
+	var repo Repository
+	err = retry(ctx, opts.Retry, "fetching repository", func() (err error) {
+		repo, err = client.GetRepository(ctx, repoName)
+		return err
+	})
 	if err != nil {
-		return fmt.Errorf("fetching repository %q: %w", repoName, github.ErrOrGHAPIErr(res, err))
+		return fmt.Errorf("fetching repository %q: %w", repoName, err)
 	}
 
-	repo := Repository{}
-	err = json.Unmarshal([]byte(res), &repo)
-	if err != nil {
-		return fmt.Errorf("unmarshaling repository: %w", err)
+	if opts.AutoProtocol && !opts.SkipCloneabilityCheck && repo.Size > 0 {
+		acceptAll := func(Repository) bool { return true }
+		if opts.UseHTTPS, err = selectCloneProtocol(ctx, [][]Repository{{repo}}, acceptAll, checkOpts); err != nil {
+			return err
+		}
 	}
 
-	if err = processRepository(ctx, repo, processor, opts); err != nil {
+	select {
+	case <-timeBudgetExceeded(ctx):
+		return fmt.Errorf("%w: %q not scheduled", ErrTimeBudgetExceeded, repo.Name)
+	default:
+	}
+
+	stats := &repoStats{}
+	startedAt := time.Now()
+	repoCtx, cancel := withRepoTimeout(context.WithValue(ctx, repoStatsKey{}, stats), opts.RepoTimeout)
+	defer cancel()
+
+	err = callRecovering(func() error {
+		return processRepository(repoCtx, repo, chainMiddlewares(processor, opts.Middlewares), opts)
+	})
+	err = repoTimeoutErr(ctx, repoCtx, opts.RepoTimeout, err)
+
+	var panicErr *PanicError
+	if errors.As(err, &panicErr) {
+		logger.Error("Processor panicked", "repository", repo.Name, "panic", panicErr.Value, "stack", string(panicErr.Stack))
+	}
+
+	outcome := newRepositoryOutcome(repo, err, time.Since(startedAt), stats)
+	opts.Hooks.onError(ctx, repo, outcome)
+	opts.Hooks.onProgress(ctx, Progress{Outcome: outcome, Done: 1, Total: 1, RateLimit: rateLimitFromContext(ctx)})
+	if err != nil {
 		return fmt.Errorf("processing %q: %w", repo.Name, err)
 	}
 
@@ -424,17 +744,48 @@ func RunForRepository(ctx context.Context, repoName string, processor Processor,
 }
 
 var (
-	errNoDefaultBranch = errors.New("no default branch")
+	cloneCacheLocks keyedMutex
+
+	// cloneRepositoryFunc allows to hook into the cloning in tests.
+	cloneRepositoryFunc = cloneRepository
 )
 
+var (
+	errNoDefaultBranch = Skip(SkipReasonNoDefaultBranch)
+	errRefNotFound     = Skip(SkipReasonRefNotFound)
+	// errInvalidRef is returned for refs that git would parse as options.
+	errInvalidRef = errors.New("invalid ref")
+)
+
+// resolveRef returns the ref to check out for the repository, falling back to the default branch.
+func resolveRef(repo Repository, opts RunOptions) string {
+	if opts.Ref != nil {
+		if ref := opts.Ref(repo); ref != "" {
+			return ref
+		}
+	}
+
+	return repo.DefaultBranchName
+}
+
+// isRefNotFoundErr checks whether a git fetch failed because the remote does not have the ref.
+func isRefNotFoundErr(err error) bool {
+	stderr, ok := exec.GetStderr(err)
+	if !ok {
+		return false
+	}
+
+	return strings.Contains(stderr, "couldn't find remote ref") || strings.Contains(stderr, "not our ref")
+}
+
 // hashCloningSubset generates a hash for the cloning subset to be used as part of the cache key when cloning repositories with a subset of files or directories.
 func hashCloningSubset(cs []string) string {
 	return fmt.Sprintf("%x", md5.Sum([]byte(strings.Join(cs, "|"))))[:16]
 }
 
-func cloneRepositoryOrGetFromCache(ctx context.Context, repo Repository, opts RunOptions) (string, error) {
-	logger := log.FromCtx(ctx)
-
+// cloneRepositoryOrGetFromCache returns a directory with a clone of the repository and a function
+// to clean it up once it is no longer needed.
+func cloneRepositoryOrGetFromCache(ctx context.Context, repo Repository, opts RunOptions) (string, func(), error) {
 	var (
 		cacheKey             string
 		shouldReturnDirectly bool
@@ -454,61 +805,83 @@ func cloneRepositoryOrGetFromCache(ctx context.Context, repo Repository, opts Ru
 		cloneDirName += "-" + hashCloningSubset(opts.CloningSubset)
 	}
 
+	if ref := resolveRef(repo, opts); ref != repo.DefaultBranchName {
+		cloneDirName += "-" + hashCloningSubset([]string{ref})
+	}
+
+	if opts.Submodules != SubmodulesNone || opts.LFS != LFSSkip {
+		cloneDirName += fmt.Sprintf("-s%dl%d", opts.Submodules, opts.LFS)
+	}
+
 	cloneDir := path.Join(reposDir, cloneDirName)
 
+	if shouldReturnDirectly {
+		if err := populateCloneDir(ctx, repo, cloneDir, opts); err != nil {
+			return "", nil, err
+		}
+
+		return cloneDir, func() { _ = os.RemoveAll(cloneDir) }, nil
+	}
+
+	// concurrent callers sharing the cache key wait for the first one to populate the cache
+	unlock, err := cloneCacheLocks.lock(ctx, cloneDir)
+	if err != nil {
+		return "", nil, fmt.Errorf("waiting for cached clone: %w", err)
+	}
+
+	err = populateCloneDir(ctx, repo, cloneDir, opts)
+	unlock()
+	if err != nil {
+		return "", nil, err
+	}
+
+	repoDir := cloneDir + "_" + randSequence(9)
+
+	cleanup, err := copyCachedClone(ctx, cloneDir, repoDir, opts)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return repoDir, cleanup, nil
+}
+
+// populateCloneDir clones the repository into cloneDir unless it exists already.
+func populateCloneDir(ctx context.Context, repo Repository, cloneDir string, opts RunOptions) error {
+	logger := log.FromCtx(ctx)
+
 	if cloneDirInfo, err := os.Stat(cloneDir); err == nil {
 		if !cloneDirInfo.IsDir() {
-			return "", fmt.Errorf("unexpected file in cloning directory: %s", cloneDir)
+			return fmt.Errorf("unexpected file in cloning directory: %s", cloneDir)
 		}
 	} else if os.IsNotExist(err) {
 		if err := os.MkdirAll(cloneDir, os.ModePerm); err != nil {
-			return "", fmt.Errorf("creating cloning directory: %w", err)
+			return fmt.Errorf("creating cloning directory: %w", err)
 		}
 
-		if err := cloneRepository(ctx, repo, cloneDir, opts); err != nil {
+		if err := cloneRepositoryFunc(ctx, repo, cloneDir, opts); err != nil {
 			if rErr := os.RemoveAll(cloneDir); rErr != nil {
 				logger.Warn("Failed to remove the clone directory", "error", rErr)
 			}
 
-			return "", err
+			return err
 		}
 	} else {
-		return "", fmt.Errorf("checking clone directory: %w", err)
-	}
-
-	if shouldReturnDirectly {
-		return cloneDir, nil
+		return fmt.Errorf("checking clone directory: %w", err)
 	}
 
-	xr := exec.NewExecerWithLogger(reposDir, logger)
-	repoDir := cloneDir + "_" + randSequence(9)
-
-	if _, err := xr.RunX(ctx, "cp", "-r", cloneDir, repoDir); err != nil {
-		if rErr := os.RemoveAll(repoDir); rErr != nil {
-			logger.Warn("Failed to remove the repo directory", "error", rErr)
-		}
-		return "", fmt.Errorf("copying repository %w", err)
-	}
-
-	return repoDir, nil
+	return nil
 }
 
-// cloneRepository clones the repository to the given directory.
-func cloneRepository(ctx context.Context, repo Repository, repoDir string, opts RunOptions) error {
+// initRepository initializes an empty repository in repoDir with the origin remote and
+// the sparse checkout configuration but without fetching anything.
+func initRepository(ctx context.Context, xr exec.Execer, repo Repository, repoDir string, opts RunOptions) error {
 	logger := log.FromCtx(ctx)
 
-	xr := exec.NewExecerWithLogger(repoDir, logger)
-
 	if _, err := xr.RunX(ctx, "git", "init"); err != nil {
 		return fmt.Errorf("cloning repository: %w", err)
 	}
 
-	repoURL := repo.SSHURL
-	if opts.UseHTTPS {
-		repoURL = repo.URL
-	}
-
-	if _, err := xr.RunX(ctx, "git", "remote", "add", "origin", repoURL); err != nil {
+	if _, err := xr.RunX(ctx, "git", "remote", "add", "origin", cloneURL(repo, opts)); err != nil {
 		return fmt.Errorf("adding origin: %w", err)
 	}
 
@@ -523,24 +896,64 @@ func cloneRepository(ctx context.Context, repo Repository, repoDir string, opts
 		}
 	}
 
-	if repo.DefaultBranchName == "" {
+	return nil
+}
+
+// cloneRepository clones the repository to the given directory.
+func cloneRepository(ctx context.Context, repo Repository, repoDir string, opts RunOptions) error {
+	logger := log.FromCtx(ctx)
+
+	xr := newCloneExecer(repoDir, logger, opts.Auth, opts.Host)
+
+	if err := initRepository(ctx, xr, repo, repoDir, opts); err != nil {
+		return err
+	}
+
+	ref := resolveRef(repo, opts)
+	if ref == "" {
 		return errNoDefaultBranch
 	}
 
-	if _, err := xr.RunX(ctx, "git", "fetch", "origin", repo.DefaultBranchName); err != nil {
-		return fmt.Errorf("fetching HEAD: %w", err)
+	if strings.HasPrefix(ref, "-") {
+		return fmt.Errorf("%w: %q", errInvalidRef, ref)
 	}
 
-	if _, err := xr.RunX(ctx, "git", "checkout", repo.DefaultBranchName); err != nil {
-		return fmt.Errorf("checking out HEAD: %w", err)
+	err := retry(ctx, opts.Retry, "fetching "+ref, func() error {
+		_, err := xr.RunX(ctx, "git", "fetch", "origin", ref)
+		return err
+	})
+	if err != nil {
+		if isRefNotFoundErr(err) {
+			return fmt.Errorf("%w: %s", errRefNotFound, ref)
+		}
+
+		return fmt.Errorf("fetching %s: %w", ref, err)
 	}
 
-	return nil
+	// fetching a branch updates its remote branch, tags and commit SHAs are not tracked as remote
+	// branches hence we check out what was just fetched.
+	if _, err := xr.RunX(ctx, "git", "rev-parse", "--verify", "--quiet", "refs/remotes/origin/"+ref); err == nil {
+		if _, err := xr.RunX(ctx, "git", "checkout", ref, "--"); err != nil {
+			return withStderr("checking out "+ref, err)
+		}
+	} else {
+		logger.Debug("Checking out fetched ref in detached mode", "ref", ref)
+		if _, err := xr.RunX(ctx, "git", "checkout", "--detach", "FETCH_HEAD"); err != nil {
+			return withStderr("checking out "+ref, err)
+		}
+	}
+
+	return completeCheckout(ctx, xr, opts)
 }
 
 func processRepository(ctx context.Context, repo Repository, processor Processor, opts RunOptions) error {
 	logger := log.FromCtx(ctx).With("repository", repo.Name)
 
+	var err error
+	if opts.Auth, err = opts.Auth.resolve(ctx); err != nil {
+		return err
+	}
+
 	processCtx := log.NewCtx(ctx, logger)
 	if opts.ContextEnricher != nil {
 		processCtx = opts.ContextEnricher(ctx, repo)
@@ -549,7 +962,8 @@ func processRepository(ctx context.Context, repo Repository, processor Processor
 	if repo.Size == 0 {
 		logger.Debug("Empty repository")
 
-		if err := processor(processCtx, repo.Name, true, exec.NewExecer("").WithEnv("GH_REPO", repo.Name)); err != nil {
+		xr := withHost(withAuth(exec.NewExecer("").WithEnv("GH_REPO", repo.Name), opts.Auth, opts.Host), opts.Host)
+		if err := runProcessor(withRepositoryInfo(processCtx, RepositoryInfo{Repository: repo}), repo, processor, true, xr, opts.Hooks); err != nil {
 			return fmt.Errorf("processing empty repository: %w", err)
 		}
 
@@ -557,17 +971,30 @@ func processRepository(ctx context.Context, repo Repository, processor Processor
 		return nil
 	}
 
-	repoDir, err := cloneRepositoryOrGetFromCache(processCtx, repo, opts)
+	if err := opts.Hooks.beforeClone(processCtx, repo); err != nil {
+		return err
+	}
+
+	if len(opts.Branches) > 0 {
+		return processBranches(processCtx, repo, processor, opts)
+	}
+
+	repoDir, cleanup, err := cloneRepositoryOrGetFromCache(processCtx, repo, opts)
 	if err != nil {
 		return err
 	}
-	defer os.RemoveAll(repoDir) //nolint:errcheck
+	defer cleanup()
 
-	if err := processor(processCtx, repo.Name, false, exec.NewExecerWithLogger(repoDir, logger)); err != nil {
+	if processCtx, err = withCheckedOutRepositoryInfo(processCtx, repo, repoDir); err != nil {
 		return err
 	}
 
-	return nil
+	xr := withHost(withAuth(exec.NewExecerWithLogger(repoDir, logger), opts.Auth, opts.Host), opts.Host)
+	if err := opts.Hooks.afterClone(processCtx, repo, xr); err != nil {
+		return err
+	}
+
+	return runProcessor(processCtx, repo, processor, false, xr, opts.Hooks)
 }
 
 // fillLines writes the lines to a file.
@@ -0,0 +1,211 @@
+package iterator
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jcchavezs/gh-iterator/exec"
+	"github.com/stretchr/testify/require"
+)
+
+func requireNoErrorAndPrintStderr(t *testing.T, err error) {
+	t.Helper()
+	if stderr, ok := exec.GetStderr(err); ok {
+		_, _ = os.Stderr.WriteString(stderr)
+	}
+
+	require.NoError(t, err)
+}
+
+// createBareRepo creates a bare repository with a `main` branch, a `release-1` branch
+// and a `v1` tag and returns its path. The repository contains README.md and docs/guide.md.
+func createBareRepo(t *testing.T) string {
+	t.Helper()
+
+	ctx := context.Background()
+	dir := t.TempDir()
+	x := exec.NewExecer(dir).WithEnv(
+		"GIT_AUTHOR_NAME", "test", "GIT_AUTHOR_EMAIL", "test@github.com",
+		"GIT_COMMITTER_NAME", "test", "GIT_COMMITTER_EMAIL", "test@github.com",
+	)
+
+	_, err := x.RunX(ctx, "git", "init", "-b", "main", "src")
+	requireNoErrorAndPrintStderr(t, err)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "src", "README.md"), []byte("Hello world!"), 0644))
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "src", "docs"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "src", "docs", "guide.md"), []byte("Guide"), 0644))
+
+	for _, args := range [][]string{
+		{"-C", "src", "config", "commit.gpgsign", "false"},
+		{"-C", "src", "add", "."},
+		{"-C", "src", "commit", "-m", "initial commit"},
+		{"-C", "src", "tag", "v1"},
+		{"-C", "src", "checkout", "-b", "release-1"},
+		{"-C", "src", "commit", "--allow-empty", "-m", "release commit"},
+		{"-C", "src", "checkout", "main"},
+		{"clone", "--bare", "src", "bare.git"},
+	} {
+		_, err := x.RunX(ctx, "git", args...)
+		requireNoErrorAndPrintStderr(t, err)
+	}
+
+	return filepath.Join(dir, "bare.git")
+}
+
+func headCommitMessage(t *testing.T, dir string) string {
+	t.Helper()
+
+	out, err := exec.NewExecer(dir).RunX(context.Background(), "git", "log", "-1", "--format=%s")
+	requireNoErrorAndPrintStderr(t, err)
+
+	return strings.TrimSpace(out)
+}
+
+func TestCloneRepositoryRef(t *testing.T) {
+	ctx := context.Background()
+	bareRepo := createBareRepo(t)
+	repo := Repository{Name: "org/repo", SSHURL: bareRepo, DefaultBranchName: "main"}
+
+	t.Run("default branch", func(t *testing.T) {
+		dir := t.TempDir()
+		err := cloneRepository(ctx, repo, dir, RunOptions{})
+		requireNoErrorAndPrintStderr(t, err)
+		require.Equal(t, "initial commit", headCommitMessage(t, dir))
+	})
+
+	t.Run("branch", func(t *testing.T) {
+		dir := t.TempDir()
+		err := cloneRepository(ctx, repo, dir, RunOptions{
+			Ref: func(Repository) string { return "release-1" },
+		})
+		requireNoErrorAndPrintStderr(t, err)
+		require.Equal(t, "release commit", headCommitMessage(t, dir))
+
+		branch, err := exec.TrimStdout(exec.NewExecer(dir).RunX(ctx, "git", "rev-parse", "--abbrev-ref", "HEAD"))
+		requireNoErrorAndPrintStderr(t, err)
+		require.Equal(t, "release-1", branch)
+	})
+
+	t.Run("tag", func(t *testing.T) {
+		dir := t.TempDir()
+		err := cloneRepository(ctx, repo, dir, RunOptions{
+			Ref: func(Repository) string { return "v1" },
+		})
+		requireNoErrorAndPrintStderr(t, err)
+		require.Equal(t, "initial commit", headCommitMessage(t, dir))
+	})
+
+	t.Run("commit SHA", func(t *testing.T) {
+		sha, err := exec.TrimStdout(exec.NewExecer(bareRepo).RunX(ctx, "git", "rev-parse", "release-1"))
+		requireNoErrorAndPrintStderr(t, err)
+
+		dir := t.TempDir()
+		err = cloneRepository(ctx, repo, dir, RunOptions{
+			Ref: func(Repository) string { return sha },
+		})
+		requireNoErrorAndPrintStderr(t, err)
+		require.Equal(t, "release commit", headCommitMessage(t, dir))
+	})
+
+	t.Run("empty ref falls back to default branch", func(t *testing.T) {
+		dir := t.TempDir()
+		err := cloneRepository(ctx, repo, dir, RunOptions{
+			Ref: func(Repository) string { return "" },
+		})
+		requireNoErrorAndPrintStderr(t, err)
+		require.Equal(t, "initial commit", headCommitMessage(t, dir))
+	})
+
+	t.Run("missing ref", func(t *testing.T) {
+		dir := t.TempDir()
+		err := cloneRepository(ctx, repo, dir, RunOptions{
+			Ref: func(Repository) string { return "release-2" },
+		})
+		require.ErrorIs(t, err, errRefNotFound)
+	})
+
+	t.Run("ref parsed as an option", func(t *testing.T) {
+		dir := t.TempDir()
+		err := cloneRepository(ctx, repo, dir, RunOptions{
+			Ref: func(Repository) string { return "--upload-pack=touch pwned" },
+		})
+		require.ErrorIs(t, err, errInvalidRef)
+	})
+
+	t.Run("no default branch", func(t *testing.T) {
+		dir := t.TempDir()
+		err := cloneRepository(ctx, Repository{Name: "org/repo", SSHURL: bareRepo}, dir, RunOptions{})
+		require.ErrorIs(t, err, errNoDefaultBranch)
+	})
+}
+
+func TestCloneURL(t *testing.T) {
+	repo := Repository{
+		Name:   "org/repo",
+		SSHURL: "git@github.com:org/repo.git",
+		URL:    "https://github.com/org/repo.git",
+	}
+
+	require.Equal(t, repo.SSHURL, cloneURL(repo, RunOptions{}))
+	require.Equal(t, repo.URL, cloneURL(repo, RunOptions{UseHTTPS: true}))
+	require.Equal(t, "file:///mirrors/org/repo.git", cloneURL(repo, RunOptions{
+		CloneURL: func(r Repository) string { return "file:///mirrors/" + r.Name + ".git" },
+	}))
+	require.Equal(t, repo.URL, cloneURL(repo, RunOptions{
+		UseHTTPS: true,
+		CloneURL: func(Repository) string { return "" },
+	}))
+}
+
+func TestCloneRepositoryFromMirror(t *testing.T) {
+	mirror := createBareRepo(t)
+	repo := Repository{Name: "org/repo", SSHURL: "git@github.com:org/repo.git", DefaultBranchName: "main"}
+
+	dir := t.TempDir()
+	err := cloneRepository(context.Background(), repo, dir, RunOptions{
+		CloneURL: func(Repository) string { return "file://" + mirror },
+	})
+	requireNoErrorAndPrintStderr(t, err)
+	require.Equal(t, "initial commit", headCommitMessage(t, dir))
+}
+
+func TestRepositoryFromContext(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("cloned repository", func(t *testing.T) {
+		repo := newTestRepository(t)
+		repo.Language = "Go"
+
+		sha, err := exec.TrimStdout(exec.NewExecer(repo.SSHURL).RunX(ctx, "git", "rev-parse", "release-1"))
+		requireNoErrorAndPrintStderr(t, err)
+
+		var info RepositoryInfo
+		err = processRepository(ctx, repo, func(ctx context.Context, repository string, isEmpty bool, xr exec.Execer) error {
+			var ok bool
+			info, ok = RepositoryFromContext(ctx)
+			require.True(t, ok)
+			require.DirExists(t, info.Dir)
+			return nil
+		}, RunOptions{Ref: func(Repository) string { return "release-1" }})
+		requireNoErrorAndPrintStderr(t, err)
+
+		require.Equal(t, repo, info.Repository)
+		require.Equal(t, sha, info.HeadSHA)
+	})
+
+	t.Run("empty repository", func(t *testing.T) {
+		repo := Repository{Name: "org/empty", DefaultBranchName: "main"}
+
+		err := processRepository(ctx, repo, func(ctx context.Context, repository string, isEmpty bool, xr exec.Execer) error {
+			info, ok := RepositoryFromContext(ctx)
+			require.True(t, ok)
+			require.Equal(t, RepositoryInfo{Repository: repo}, info)
+			return nil
+		}, RunOptions{})
+		requireNoErrorAndPrintStderr(t, err)
+	})
+}
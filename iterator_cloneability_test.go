@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"log/slog"
+	"strings"
 	"testing"
 
 	"github.com/jcchavezs/gh-iterator/exec"
@@ -24,11 +25,11 @@ func TestSelectCloneabilityCheckCandidates(t *testing.T) {
 	acceptAll := func(Repository) bool { return true }
 
 	t.Run("empty repo pages returns empty slice", func(t *testing.T) {
-		result := selectCloneabilityCheckCandidates([][]Repository{}, acceptAll)
+		result := selectCloneabilityCheckCandidates([][]Repository{}, acceptAll, defaultCloneabilityChecks)
 		require.Empty(t, result)
 	})
 
-	t.Run("returns up to maxCloneabilityChecks repositories", func(t *testing.T) {
+	t.Run("returns up to defaultCloneabilityChecks repositories", func(t *testing.T) {
 		repoPages := [][]Repository{
 			{
 				{Name: "org/repo-1"},
@@ -37,21 +38,21 @@ func TestSelectCloneabilityCheckCandidates(t *testing.T) {
 				{Name: "org/repo-4"},
 			},
 		}
-		result := selectCloneabilityCheckCandidates(repoPages, acceptAll)
-		require.Len(t, result, maxCloneabilityChecks)
+		result := selectCloneabilityCheckCandidates(repoPages, acceptAll, defaultCloneabilityChecks)
+		require.Len(t, result, defaultCloneabilityChecks)
 		require.Equal(t, "org/repo-1", result[0].Name)
 		require.Equal(t, "org/repo-2", result[1].Name)
 		require.Equal(t, "org/repo-3", result[2].Name)
 	})
 
-	t.Run("returns fewer than maxCloneabilityChecks when not enough repos", func(t *testing.T) {
+	t.Run("returns fewer than defaultCloneabilityChecks when not enough repos", func(t *testing.T) {
 		repoPages := [][]Repository{
 			{
 				{Name: "org/repo-1"},
 				{Name: "org/repo-2"},
 			},
 		}
-		result := selectCloneabilityCheckCandidates(repoPages, acceptAll)
+		result := selectCloneabilityCheckCandidates(repoPages, acceptAll, defaultCloneabilityChecks)
 		require.Len(t, result, 2)
 	})
 
@@ -62,7 +63,7 @@ func TestSelectCloneabilityCheckCandidates(t *testing.T) {
 				{Name: "org/repo-1"},
 			},
 		}
-		result := selectCloneabilityCheckCandidates(repoPages, acceptAll)
+		result := selectCloneabilityCheckCandidates(repoPages, acceptAll, defaultCloneabilityChecks)
 		require.Len(t, result, 1)
 		require.Equal(t, "org/repo-1", result[0].Name)
 	})
@@ -75,7 +76,7 @@ func TestSelectCloneabilityCheckCandidates(t *testing.T) {
 			},
 		}
 		filterActive := func(r Repository) bool { return !r.Archived }
-		result := selectCloneabilityCheckCandidates(repoPages, filterActive)
+		result := selectCloneabilityCheckCandidates(repoPages, filterActive, defaultCloneabilityChecks)
 		require.Len(t, result, 1)
 		require.Equal(t, "org/repo-2", result[0].Name)
 	})
@@ -87,8 +88,8 @@ func TestSelectCloneabilityCheckCandidates(t *testing.T) {
 			{{Name: "org/repo-3"}},
 			{{Name: "org/repo-4"}},
 		}
-		result := selectCloneabilityCheckCandidates(repoPages, acceptAll)
-		require.Len(t, result, maxCloneabilityChecks)
+		result := selectCloneabilityCheckCandidates(repoPages, acceptAll, defaultCloneabilityChecks)
+		require.Len(t, result, defaultCloneabilityChecks)
 		require.Equal(t, "org/repo-1", result[0].Name)
 		require.Equal(t, "org/repo-2", result[1].Name)
 		require.Equal(t, "org/repo-3", result[2].Name)
@@ -102,7 +103,7 @@ func TestSelectCloneabilityCheckCandidates(t *testing.T) {
 			},
 		}
 		filterActive := func(r Repository) bool { return !r.Archived }
-		result := selectCloneabilityCheckCandidates(repoPages, filterActive)
+		result := selectCloneabilityCheckCandidates(repoPages, filterActive, defaultCloneabilityChecks)
 		require.Empty(t, result)
 	})
 }
@@ -115,7 +116,7 @@ func TestCheckCloneability(t *testing.T) {
 			return mock.Execer{}
 		})
 
-		err := checkCloneability(ctx, [][]Repository{}, func(Repository) bool { return true }, false)
+		err := checkCloneability(ctx, [][]Repository{}, func(Repository) bool { return true }, RunOptions{})
 		require.Error(t, err)
 		require.EqualError(t, err, "no repositories to check cloneability")
 	})
@@ -144,7 +145,7 @@ func TestCheckCloneability(t *testing.T) {
 			}
 		})
 
-		err := checkCloneability(ctx, repoPages, func(Repository) bool { return true }, false)
+		err := checkCloneability(ctx, repoPages, func(Repository) bool { return true }, RunOptions{})
 		require.NoError(t, err)
 
 		require.Equal(t, "git", capturedCommand)
@@ -153,6 +154,37 @@ func TestCheckCloneability(t *testing.T) {
 		require.Equal(t, expectedArgs, capturedArgs)
 	})
 
+	t.Run("successful cloneability check with clone URL", func(t *testing.T) {
+		repoPages := [][]Repository{
+			{
+				{
+					Name:   "test-org/test-repo",
+					SSHURL: "git@github.com:test-org/test-repo.git",
+					URL:    "https://github.com/test-org/test-repo.git",
+				},
+			},
+		}
+
+		var capturedArgs []string
+
+		overrideExecerFactory(t, func(string, *slog.Logger) exec.Execer {
+			return mock.Execer{
+				RunXFn: func(ctx context.Context, command string, args ...string) (string, error) {
+					capturedArgs = args
+					return "", nil
+				},
+			}
+		})
+
+		err := checkCloneability(ctx, repoPages, func(Repository) bool { return true }, RunOptions{
+			CloneURL: func(r Repository) string { return "https://proxy.example.com/" + r.Name + ".git" },
+		})
+		require.NoError(t, err)
+
+		expectedArgs := []string{"ls-remote", "--exit-code", "https://proxy.example.com/test-org/test-repo.git"}
+		require.Equal(t, expectedArgs, capturedArgs)
+	})
+
 	t.Run("failed cloneability check", func(t *testing.T) {
 		repoPages := [][]Repository{
 			{
@@ -173,7 +205,7 @@ func TestCheckCloneability(t *testing.T) {
 			}
 		})
 
-		err := checkCloneability(ctx, repoPages, func(Repository) bool { return true }, false)
+		err := checkCloneability(ctx, repoPages, func(Repository) bool { return true }, RunOptions{})
 		require.Error(t, err)
 		require.ErrorIs(t, err, mockErr)
 	})
@@ -209,7 +241,7 @@ func TestCheckCloneability(t *testing.T) {
 			}
 		})
 
-		err := checkCloneability(ctx, repoPages, func(Repository) bool { return true }, false)
+		err := checkCloneability(ctx, repoPages, func(Repository) bool { return true }, RunOptions{})
 		require.Error(t, err)
 		require.ErrorIs(t, err, mockErr1)
 		require.ErrorIs(t, err, mockErr2)
@@ -245,7 +277,7 @@ func TestCheckCloneability(t *testing.T) {
 			}
 		})
 
-		err := checkCloneability(ctx, repoPages, func(Repository) bool { return true }, false)
+		err := checkCloneability(ctx, repoPages, func(Repository) bool { return true }, RunOptions{})
 		require.NoError(t, err)
 		require.Equal(t, 2, callCount)
 	})
@@ -280,7 +312,7 @@ func TestCheckCloneability(t *testing.T) {
 			return r.Name == "test-org/active-repo"
 		}
 
-		err := checkCloneability(ctx, repoPages, filterIn, false)
+		err := checkCloneability(ctx, repoPages, filterIn, RunOptions{})
 		require.NoError(t, err)
 
 		// Should use the active-repo URL, not the archived one
@@ -289,3 +321,110 @@ func TestCheckCloneability(t *testing.T) {
 		require.Equal(t, expectedURL, capturedArgs[2])
 	})
 }
+
+func TestCheckCloneabilityCandidates(t *testing.T) {
+	repoPages := [][]Repository{
+		{
+			{Name: "test-org/repo-1"},
+			{Name: "test-org/repo-2"},
+			{Name: "test-org/repo-3"},
+			{Name: "test-org/repo-4"},
+			{Name: "test-org/repo-5"},
+		},
+	}
+
+	callCount := 0
+	overrideExecerFactory(t, func(string, *slog.Logger) exec.Execer {
+		return mock.Execer{
+			RunXFn: func(ctx context.Context, command string, args ...string) (string, error) {
+				callCount++
+				return "", errors.New("authentication failed")
+			},
+		}
+	})
+
+	err := checkCloneability(context.Background(), repoPages, func(Repository) bool { return true }, RunOptions{
+		CloneabilityCheckCandidates: 5,
+	})
+	require.Error(t, err)
+	require.Equal(t, 5, callCount)
+}
+
+func TestSelectCloneProtocol(t *testing.T) {
+	ctx := context.Background()
+	acceptAll := func(Repository) bool { return true }
+	repoPages := [][]Repository{
+		{
+			{
+				Name:   "test-org/test-repo",
+				SSHURL: "git@github.com:test-org/test-repo.git",
+				URL:    "https://github.com/test-org/test-repo.git",
+			},
+		},
+	}
+
+	// mockProtocols mocks the cloneability check passing only for the given URL prefixes.
+	mockProtocols := func(t *testing.T, workingPrefixes ...string) *[]string {
+		var checkedURLs []string
+		overrideExecerFactory(t, func(string, *slog.Logger) exec.Execer {
+			return mock.Execer{
+				RunXFn: func(ctx context.Context, command string, args ...string) (string, error) {
+					checkedURLs = append(checkedURLs, args[2])
+					for _, p := range workingPrefixes {
+						if strings.HasPrefix(args[2], p) {
+							return "", nil
+						}
+					}
+
+					return "", errors.New("authentication failed")
+				},
+			}
+		})
+
+		return &checkedURLs
+	}
+
+	t.Run("preferred protocol works", func(t *testing.T) {
+		checkedURLs := mockProtocols(t, "git@", "https://")
+
+		useHTTPS, err := selectCloneProtocol(ctx, repoPages, acceptAll, RunOptions{AutoProtocol: true})
+		require.NoError(t, err)
+		require.False(t, useHTTPS)
+		require.Equal(t, []string{"git@github.com:test-org/test-repo.git"}, *checkedURLs)
+	})
+
+	t.Run("falls back to HTTPS", func(t *testing.T) {
+		mockProtocols(t, "https://")
+
+		useHTTPS, err := selectCloneProtocol(ctx, repoPages, acceptAll, RunOptions{AutoProtocol: true})
+		require.NoError(t, err)
+		require.True(t, useHTTPS)
+	})
+
+	t.Run("falls back to SSH", func(t *testing.T) {
+		mockProtocols(t, "git@")
+
+		useHTTPS, err := selectCloneProtocol(ctx, repoPages, acceptAll, RunOptions{AutoProtocol: true, UseHTTPS: true})
+		require.NoError(t, err)
+		require.False(t, useHTTPS)
+	})
+
+	t.Run("no fallback without auto protocol", func(t *testing.T) {
+		checkedURLs := mockProtocols(t, "https://")
+
+		_, err := selectCloneProtocol(ctx, repoPages, acceptAll, RunOptions{})
+		require.Error(t, err)
+		require.Len(t, *checkedURLs, 1)
+	})
+
+	t.Run("both protocols fail", func(t *testing.T) {
+		checkedURLs := mockProtocols(t)
+
+		_, err := selectCloneProtocol(ctx, repoPages, acceptAll, RunOptions{AutoProtocol: true})
+		require.Error(t, err)
+		require.Equal(t, []string{
+			"git@github.com:test-org/test-repo.git",
+			"https://github.com/test-org/test-repo.git",
+		}, *checkedURLs)
+	})
+}
@@ -9,6 +9,7 @@ import (
 	"os"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/jcchavezs/gh-iterator/exec"
 	"github.com/jcchavezs/gh-iterator/exec/mock"
@@ -36,6 +37,9 @@ func TestFillLines(t *testing.T) {
 	require.Equal(t, "README.md\nLICENSE\n", string(fc))
 }
 
+// processAll is the skip reason function of runs that process all repositories.
+func processAll(Repository) string { return "" }
+
 func TestMain(m *testing.M) {
 	goleak.VerifyTestMain(m)
 }
@@ -84,7 +88,7 @@ func TestRunForReposConcurrently(t *testing.T) {
 
 	mockLSRemoteCheck(t)
 
-	result, err := runForReposConcurrently(ctx, repoPages, nOfWorkers, func(repo Repository) bool { return true }, processRepository, processor, opts)
+	result, err := runForReposConcurrently(ctx, repoPages, nOfWorkers, processAll, processRepository, processor, opts)
 	require.NoError(t, err)
 	require.Equal(t, 1000, result.Found)
 	require.Equal(t, 1000, result.Inspected)
@@ -123,17 +127,17 @@ func TestRunForReposConcurrentlyFilteredRepos(t *testing.T) {
 		Debug: true,
 	}
 
-	filterIn := func(repo Repository) bool {
-		return repo.Language == "Go"
-	}
+	skipReason := SearchOptions{Languages: []string{"Go"}}.makeSkipReason()
 
 	mockLSRemoteCheck(t)
 
-	result, err := runForReposConcurrently(ctx, repoPages, nOfWorkers, filterIn, processRepository, processor, opts)
+	result, err := runForReposConcurrently(ctx, repoPages, nOfWorkers, skipReason, processRepository, processor, opts)
 	require.NoError(t, err)
 	require.Equal(t, 3, result.Found)
 	require.Equal(t, 3, result.Inspected)
 	require.Equal(t, 2, result.Processed)
+	require.Equal(t, 1, result.Skipped)
+	require.Equal(t, map[string]int{SkipReasonLanguage: 1}, result.SkipReasons)
 
 	processedMux.Lock()
 	defer processedMux.Unlock()
@@ -152,7 +156,7 @@ func TestRunForReposConcurrentlyEmptyRepos(t *testing.T) {
 
 	opts := Options{}
 
-	result, err := runForReposConcurrently(ctx, repoPages, nOfWorkers, func(repo Repository) bool { return true }, processRepository, processor, opts)
+	result, err := runForReposConcurrently(ctx, repoPages, nOfWorkers, processAll, processRepository, processor, opts)
 	require.NoError(t, err)
 	require.Equal(t, 0, result.Found)
 	require.Equal(t, 0, result.Inspected)
@@ -181,8 +185,22 @@ func TestRunForReposConcurrentlyContextCancelled(t *testing.T) {
 	opts := Options{}
 	mockLSRemoteCheck(t)
 
-	_, err := runForReposConcurrently(ctx, repoPages, nOfWorkers, func(repo Repository) bool { return true }, processRepository, processor, opts)
+	_, err := runForReposConcurrently(ctx, repoPages, nOfWorkers, processAll, processRepository, processor, opts)
+
+	require.ErrorIs(t, err, context.Canceled)
+}
+
+func TestRunForReposConcurrentlyContextCancelledAfterScheduling(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 
+	// the context is cancelled while the last repository is processed, once all of them were
+	// scheduled.
+	_, err := runForReposConcurrently(ctx, [][]Repository{{{Name: "repo1"}}}, 1, processAll, func(ctx context.Context, repo Repository, processor Processor, opts RunOptions) error {
+		time.Sleep(20 * time.Millisecond)
+		cancel()
+		return nil
+	}, nil, RunOptions{})
 	require.ErrorIs(t, err, context.Canceled)
 }
 
@@ -208,7 +226,40 @@ func TestRunForReposConcurrentlyErrorInProcessor(t *testing.T) {
 
 	mockLSRemoteCheck(t)
 
-	_, err := runForReposConcurrently(ctx, repoPages, nOfWorkers, func(repo Repository) bool { return true }, processRepository, processor, opts)
+	_, err := runForReposConcurrently(ctx, repoPages, nOfWorkers, processAll, processRepository, processor, opts)
 	require.Error(t, err)
 	require.Contains(t, err.Error(), "error processing repo2")
 }
+
+func TestRunForReposConcurrentlyErrorWhileScheduling(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	ctx := context.Background()
+
+	var repoPage []Repository
+	for i := range 10 {
+		repoPage = append(repoPage, Repository{Name: fmt.Sprintf("repo%d", i)})
+	}
+
+	// the only worker fails while the rest of the repositories are still being scheduled, the
+	// scheduling stops instead of blocking on the full channel and the done channel is closed once.
+	_, err := runForReposConcurrently(ctx, [][]Repository{repoPage}, 1, processAll, func(ctx context.Context, repo Repository, processor Processor, opts RunOptions) error {
+		// gives time to the scheduling to block on the full channel
+		time.Sleep(50 * time.Millisecond)
+		return errors.New("boom")
+	}, nil, RunOptions{})
+	require.EqualError(t, err, `processing "repo0": boom`)
+}
+
+func TestProcessRepositoryHost(t *testing.T) {
+	var ghHost string
+	processor := func(ctx context.Context, repository string, isEmpty bool, xr exec.Execer) error {
+		var err error
+		ghHost, err = exec.TrimStdout(xr.RunX(ctx, "sh", "-c", "echo $GH_HOST"))
+		return err
+	}
+
+	err := processRepository(context.Background(), Repository{Name: "my-org/empty"}, processor, Options{Host: "ghe.example.com"})
+	requireNoErrorAndPrintStderr(t, err)
+	require.Equal(t, "ghe.example.com", ghHost)
+}
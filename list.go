@@ -5,6 +5,7 @@ import (
 	"log/slog"
 
 	iteratorexec "github.com/jcchavezs/gh-iterator/exec"
+	"github.com/jcchavezs/gh-iterator/github"
 	"github.com/jcchavezs/gh-iterator/internal/log"
 )
 
@@ -15,6 +16,22 @@ type ListOptions struct {
 
 	// Log handler
 	LogHandler slog.Handler
+
+	// Auth is the authentication used by all the gh and git commands, including the ones run by
+	// the callback. If nil, the ambient gh and git authentication is used.
+	Auth *Auth
+
+	// Client is the GitHub API client used to fetch the repositories. If nil, the gh CLI is used
+	// with Auth and Host.
+	Client github.Client
+
+	// Host is the GitHub hostname e.g. a GitHub Enterprise Server instance, by default the host
+	// configured in gh. It is also set as GH_HOST in the execers passed to the callback.
+	Host string
+
+	// Retry is the policy to retry fetching the repositories from the API when it fails due to
+	// transient errors. If nil, nothing is retried.
+	Retry *RetryOptions
 }
 
 // ListForOrganization lists the repositories for the given organization and processes them concurrently using the provided callback function.
@@ -22,7 +39,16 @@ type ListOptions struct {
 func ListForOrganization(ctx context.Context, orgName string, searchOpts SearchOptions, callback func(ctx context.Context, xr iteratorexec.Execer, repository string) error, opts ListOptions) (Result, error) {
 	ctx, logger := setupLogger(ctx, opts.LogHandler, false)
 
-	repoPages, err := getRepoPages(ctx, searchOpts, orgName, logger)
+	auth, err := opts.Auth.resolve(ctx)
+	if err != nil {
+		return Result{}, err
+	}
+
+	if opts.Client == nil {
+		searchOpts.ListingCache = opts.Auth.scopeListingCache(searchOpts.ListingCache)
+	}
+
+	repoPages, err := getRepoPages(ctx, searchOpts, orgName, apiClient(opts.Client, logger, auth, opts.Host), opts.Retry)
 	if err != nil {
 		return Result{}, err
 	}
@@ -32,18 +58,21 @@ func ListForOrganization(ctx context.Context, orgName string, searchOpts SearchO
 		nOfWorkers = defaultNumberOfWorkers
 	}
 
-	filterIn := searchOpts.MakeFilterIn()
-	xr := iteratorexec.NewExecerWithLogger("", logger)
-
 	return runForReposConcurrently(
 		ctx,
 		repoPages,
 		nOfWorkers,
-		filterIn,
+		searchOpts.makeSkipReason(),
 		func(ctx context.Context, repo Repository, processor Processor, opts Options) error {
 			logger := log.FromCtx(ctx).With("repository", repo.Name)
-			processCtx := log.NewCtx(ctx, logger)
+			processCtx := withRepositoryInfo(log.NewCtx(ctx, logger), RepositoryInfo{Repository: repo})
+
+			auth, err := opts.Auth.resolve(ctx)
+			if err != nil {
+				return err
+			}
 
+			xr := withHost(withAuth(iteratorexec.NewExecerWithLogger("", logger), auth, opts.Host), opts.Host)
 			if err := processor(processCtx, repo.Name, repo.Size == 0, xr.WithEnv("GH_REPO", repo.Name)); err != nil {
 				return err
 			}
@@ -55,6 +84,8 @@ func ListForOrganization(ctx context.Context, orgName string, searchOpts SearchO
 		}, RunOptions{
 			NumberOfWorkers: opts.NumberOfWorkers,
 			LogHandler:      opts.LogHandler,
+			Auth:            opts.Auth,
+			Host:            opts.Host,
 		},
 	)
 }
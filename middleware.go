@@ -0,0 +1,119 @@
+package iterator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"time"
+
+	"github.com/jcchavezs/gh-iterator/exec"
+	"github.com/jcchavezs/gh-iterator/internal/log"
+)
+
+// Middleware wraps a processor to add behaviour around it e.g. logging or timeouts.
+type Middleware func(Processor) Processor
+
+// chainMiddlewares wraps the processor with the middlewares, the first one being the outermost.
+func chainMiddlewares(processor Processor, middlewares []Middleware) Processor {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		processor = middlewares[i](processor)
+	}
+
+	return processor
+}
+
+// PanicError is the error of a processor that panicked.
+type PanicError struct {
+	// Value is the value passed to panic.
+	Value any
+	// Stack is the stack trace of the goroutine when it panicked. It is left out of the error
+	// message to keep it a single line, the run logs it once.
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.Value)
+}
+
+// newPanicError creates a PanicError from a recovered value with the current stack trace.
+func newPanicError(v any) *PanicError {
+	return &PanicError{Value: v, Stack: debug.Stack()}
+}
+
+// TimingValueKey is the key of the processing duration attached by TimingMiddleware.
+const TimingValueKey = "processing_duration"
+
+// TimingMiddleware attaches the time spent by the processor to the outcome of the repository
+// with the TimingValueKey key. Unlike RepositoryOutcome.Duration it does not include the cloning.
+func TimingMiddleware() Middleware {
+	return func(next Processor) Processor {
+		return func(ctx context.Context, repository string, isEmpty bool, exec exec.Execer) error {
+			startedAt := time.Now()
+			defer func() {
+				AttachValue(ctx, TimingValueKey, time.Since(startedAt).Round(time.Millisecond))
+			}()
+
+			return next(ctx, repository, isEmpty, exec)
+		}
+	}
+}
+
+// RecoverMiddleware recovers the processor from panics returning a PanicError instead. The run
+// recovers panics anyway, this middleware makes them visible as errors to the outer middlewares
+// and the AfterProcess hook.
+func RecoverMiddleware() Middleware {
+	return func(next Processor) Processor {
+		return func(ctx context.Context, repository string, isEmpty bool, exec exec.Execer) (err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					err = newPanicError(r)
+				}
+			}()
+
+			return next(ctx, repository, isEmpty, exec)
+		}
+	}
+}
+
+// TimeoutMiddleware cancels the context passed to the processor once the timeout is exceeded.
+// The processor is expected to honour the context e.g. through the execer.
+func TimeoutMiddleware(timeout time.Duration) Middleware {
+	return func(next Processor) Processor {
+		return func(ctx context.Context, repository string, isEmpty bool, exec exec.Execer) error {
+			ctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+
+			if err := next(ctx, repository, isEmpty, exec); err != nil {
+				if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+					return fmt.Errorf("processing timed out after %s: %w", timeout, err)
+				}
+
+				return err
+			}
+
+			return nil
+		}
+	}
+}
+
+// LoggingMiddleware logs when the processor starts and finishes with its duration and error if
+// any, using the logger of the repository.
+func LoggingMiddleware() Middleware {
+	return func(next Processor) Processor {
+		return func(ctx context.Context, repository string, isEmpty bool, exec exec.Execer) error {
+			logger := log.FromCtx(ctx)
+			logger.Info("Processing repository")
+
+			startedAt := time.Now()
+			err := next(ctx, repository, isEmpty, exec)
+			if err != nil {
+				logger.Error("Failed to process repository", "duration", time.Since(startedAt), "error", err)
+			} else {
+				logger.Info("Processed repository", "duration", time.Since(startedAt))
+			}
+
+			return err
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package iterator
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/jcchavezs/gh-iterator/exec"
+	"github.com/jcchavezs/gh-iterator/internal/log"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChainMiddlewares(t *testing.T) {
+	var calls []string
+	middleware := func(name string) Middleware {
+		return func(next Processor) Processor {
+			return func(ctx context.Context, repository string, isEmpty bool, exec exec.Execer) error {
+				calls = append(calls, name)
+				return next(ctx, repository, isEmpty, exec)
+			}
+		}
+	}
+
+	processor := chainMiddlewares(func(ctx context.Context, repository string, isEmpty bool, exec exec.Execer) error {
+		calls = append(calls, "processor")
+		return nil
+	}, []Middleware{middleware("first"), middleware("second")})
+
+	require.NoError(t, processor(context.Background(), "my-org/repo", false, nil))
+	require.Equal(t, []string{"first", "second", "processor"}, calls)
+}
+
+func TestTimingMiddleware(t *testing.T) {
+	stats := &repoStats{}
+	ctx := context.WithValue(context.Background(), repoStatsKey{}, stats)
+
+	err := TimingMiddleware()(func(ctx context.Context, repository string, isEmpty bool, exec exec.Execer) error {
+		time.Sleep(10 * time.Millisecond)
+		return nil
+	})(ctx, "my-org/repo", false, nil)
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, stats.values[TimingValueKey], 10*time.Millisecond)
+}
+
+func TestRecoverMiddleware(t *testing.T) {
+	err := RecoverMiddleware()(func(ctx context.Context, repository string, isEmpty bool, exec exec.Execer) error {
+		panic("boom")
+	})(context.Background(), "my-org/repo", false, nil)
+
+	var panicErr *PanicError
+	require.ErrorAs(t, err, &panicErr)
+	require.Equal(t, "boom", panicErr.Value)
+	require.Contains(t, string(panicErr.Stack), "TestRecoverMiddleware")
+	require.EqualError(t, err, "panic: boom")
+}
+
+func TestTimeoutMiddleware(t *testing.T) {
+	processor := TimeoutMiddleware(10 * time.Millisecond)(func(ctx context.Context, repository string, isEmpty bool, exec exec.Execer) error {
+		if repository == "my-org/fast" {
+			return nil
+		}
+
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	require.NoError(t, processor(context.Background(), "my-org/fast", false, nil))
+
+	err := processor(context.Background(), "my-org/slow", false, nil)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.ErrorContains(t, err, "processing timed out after 10ms")
+}
+
+func TestLoggingMiddleware(t *testing.T) {
+	var buf bytes.Buffer
+	ctx := log.NewCtx(context.Background(), slog.New(slog.NewTextHandler(&buf, nil)))
+
+	err := LoggingMiddleware()(func(ctx context.Context, repository string, isEmpty bool, exec exec.Execer) error {
+		return errors.New("boom")
+	})(ctx, "my-org/repo", false, nil)
+	require.EqualError(t, err, "boom")
+
+	require.Contains(t, buf.String(), `msg="Processing repository"`)
+	require.Contains(t, buf.String(), `msg="Failed to process repository"`)
+	require.Contains(t, buf.String(), "error=boom")
+}
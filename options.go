@@ -3,6 +3,8 @@ package iterator
 import (
 	"strings"
 	"time"
+
+	"github.com/jcchavezs/gh-iterator/github"
 )
 
 // Visibility represents the visibility of the repositories.
@@ -86,6 +88,10 @@ type SearchOptions struct {
 	FilterIn func(Repository) bool
 	// Cache the response, e.g. "3600s", "60m", "1h"
 	Cache time.Duration
+	// ListingCache persists the listing on disk keyed by identity, organization and query,
+	// revalidating it with conditional requests or replaying it offline. With the gh CLI client,
+	// it is scoped by the identity of Auth.TokenSource if it is a github.IdentifiedTokenSource.
+	ListingCache *github.ListingCache
 }
 
 const (
@@ -95,68 +101,103 @@ const (
 
 // MakeFilterIn creates a filter function based on the SearchOptions.
 func (so SearchOptions) MakeFilterIn() func(Repository) bool {
-	filters := []func(Repository) bool{}
+	skipReason := so.makeSkipReason()
+	return func(r Repository) bool {
+		return skipReason(r) == ""
+	}
+}
+
+// makeSkipReason creates a function returning the reason to leave a repository out based on the
+// SearchOptions, or an empty string if the repository goes in.
+func (so SearchOptions) makeSkipReason() func(Repository) string {
+	filters := []func(Repository) string{}
 	if so.FilterIn != nil {
-		filters = append(filters, so.FilterIn)
+		filters = append(filters, func(r Repository) string {
+			if !so.FilterIn(r) {
+				return SkipReasonFilteredOut
+			}
+			return ""
+		})
 	}
 
 	if len(so.Languages) > 0 {
-		filters = append(filters, func(r Repository) bool {
+		filters = append(filters, func(r Repository) string {
 			for _, l := range so.Languages {
 				if strings.EqualFold(l, r.Language) {
-					return true
+					return ""
 				}
 			}
 
-			return false
+			return SkipReasonLanguage
 		})
 	}
 
 	switch so.ArchiveCondition {
 	case OnlyArchived:
-		filters = append(filters, func(r Repository) bool {
-			return r.Archived
+		filters = append(filters, func(r Repository) string {
+			if !r.Archived {
+				return SkipReasonNotArchived
+			}
+			return ""
 		})
 	case OmitArchived:
-		filters = append(filters, func(r Repository) bool {
-			return !r.Archived
+		filters = append(filters, func(r Repository) string {
+			if r.Archived {
+				return SkipReasonArchived
+			}
+			return ""
 		})
 	}
 
 	switch so.Source {
 	case OnlyForks:
-		filters = append(filters, func(r Repository) bool {
-			return r.Fork
+		filters = append(filters, func(r Repository) string {
+			if !r.Fork {
+				return SkipReasonNotFork
+			}
+			return ""
 		})
 	case OnlyNonForks:
-		filters = append(filters, func(r Repository) bool {
-			return !r.Fork
+		filters = append(filters, func(r Repository) string {
+			if r.Fork {
+				return SkipReasonFork
+			}
+			return ""
 		})
 	}
 
 	if so.Visibility != VisibilityNone {
-		filters = append(filters, func(r Repository) bool {
-			return r.Visibility == so.Visibility.String()
+		filters = append(filters, func(r Repository) string {
+			if r.Visibility != so.Visibility.String() {
+				return SkipReasonVisibility
+			}
+			return ""
 		})
 	}
 
 	switch so.SizeCondition {
 	case NotEmpty:
-		filters = append(filters, func(r Repository) bool {
-			return r.Size > 0
+		filters = append(filters, func(r Repository) string {
+			if r.Size == 0 {
+				return SkipReasonEmpty
+			}
+			return ""
 		})
 	case OnlyEmpty:
-		filters = append(filters, func(r Repository) bool {
-			return r.Size == 0
+		filters = append(filters, func(r Repository) string {
+			if r.Size > 0 {
+				return SkipReasonNotEmpty
+			}
+			return ""
 		})
 	}
 
-	return func(r Repository) bool {
+	return func(r Repository) string {
 		for _, filter := range filters {
-			if !filter(r) {
-				return false
+			if reason := filter(r); reason != "" {
+				return reason
 			}
 		}
-		return true
+		return ""
 	}
 }
@@ -0,0 +1,134 @@
+package iterator
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// OutcomeStatus is the status of a repository once the run is over.
+type OutcomeStatus int
+
+const (
+	// OutcomeProcessed means the processor ran successfully.
+	OutcomeProcessed OutcomeStatus = iota
+	// OutcomeSkipped means the repository was not processed e.g. it was left out by the filtering,
+	// the ref to check out does not exist or the processor returned ErrSkip.
+	OutcomeSkipped
+	// OutcomeFailed means processing the repository failed.
+	OutcomeFailed
+	// OutcomeUnscheduled means the repository was not scheduled because the run exceeded
+	// Options.TimeBudget.
+	OutcomeUnscheduled
+)
+
+func (s OutcomeStatus) String() string {
+	switch s {
+	case OutcomeProcessed:
+		return "processed"
+	case OutcomeSkipped:
+		return "skipped"
+	case OutcomeFailed:
+		return "failed"
+	case OutcomeUnscheduled:
+		return "unscheduled"
+	default:
+		return ""
+	}
+}
+
+// RepositoryOutcome is the outcome of processing a repository.
+type RepositoryOutcome struct {
+	// Repository is the name of the repository.
+	Repository string
+	// Status is the status of the repository.
+	Status OutcomeStatus
+	// Err is the error processing the repository or the error to skip it if any.
+	Err error
+	// SkipReason is the reason to skip the repository if skipped.
+	SkipReason string
+	// Duration is the time spent processing the repository, including the cloning.
+	Duration time.Duration
+	// Attempts is the number of attempts of the network operation that needed the most for the
+	// repository e.g. 2 if cloning succeeded after a retry. It is 0 if nothing was fetched.
+	Attempts int
+	// Values are the values attached by the processor with AttachValue.
+	Values map[string]any
+	// Findings are the findings reported by the processor with ReportFinding.
+	Findings []Finding
+}
+
+// AttachValue attaches a value to the outcome of the repository being processed e.g. to be
+// included in a report. It does nothing if the context does not belong to a repository
+// being processed.
+func AttachValue(ctx context.Context, key string, value any) {
+	s := repoStatsFromContext(ctx)
+	if s == nil {
+		return
+	}
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if s.values == nil {
+		s.values = map[string]any{}
+	}
+
+	s.values[key] = value
+}
+
+// newRepositoryOutcome creates the outcome of processing the repository.
+func newRepositoryOutcome(repo Repository, err error, duration time.Duration, stats *repoStats) RepositoryOutcome {
+	o := RepositoryOutcome{Repository: repo.Name, Err: err, Duration: duration}
+
+	if err == nil {
+		o.Status = OutcomeProcessed
+	} else if reason, ok := SkipReason(err); ok {
+		o.Status, o.SkipReason = OutcomeSkipped, reason
+	} else {
+		o.Status = OutcomeFailed
+	}
+
+	stats.mux.Lock()
+	o.Attempts, o.Values = stats.attempts, stats.values
+	for _, f := range stats.findings {
+		f.Repository = repo.Name
+		o.Findings = append(o.Findings, f)
+	}
+	stats.mux.Unlock()
+
+	return o
+}
+
+type repoStatsKey struct{}
+
+// repoStats collects the stats of processing a repository to be reported in its outcome.
+type repoStats struct {
+	mux      sync.Mutex
+	attempts int
+	values   map[string]any
+	findings []Finding
+}
+
+func repoStatsFromContext(ctx context.Context) *repoStats {
+	s, _ := ctx.Value(repoStatsKey{}).(*repoStats)
+	return s
+}
+
+// recordAttempt records the attempt keeping the highest one across operations.
+func (s *repoStats) recordAttempt(attempt int) {
+	if s == nil {
+		return
+	}
+
+	s.mux.Lock()
+	s.attempts = max(s.attempts, attempt)
+	s.mux.Unlock()
+}
+
+func (s *repoStats) getAttempts() int {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	return s.attempts
+}
@@ -0,0 +1,105 @@
+package iterator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/jcchavezs/gh-iterator/exec"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunForReposConcurrentlyOutcomes(t *testing.T) {
+	ctx := context.Background()
+	repoPages := [][]Repository{{{Name: "repo1"}, {Name: "repo2"}, {Name: "repo3"}}}
+
+	processorCaller := func(ctx context.Context, repo Repository, processor Processor, opts RunOptions) error {
+		return processor(ctx, repo.Name, false, nil)
+	}
+
+	outcomesByRepo := func(res Result) map[string]RepositoryOutcome {
+		outcomes := map[string]RepositoryOutcome{}
+		for _, o := range res.Outcomes {
+			outcomes[o.Repository] = o
+		}
+		return outcomes
+	}
+
+	t.Run("statuses and values", func(t *testing.T) {
+		res, err := runForReposConcurrently(ctx, repoPages, 2, processAll, processorCaller,
+			func(ctx context.Context, repository string, isEmpty bool, xr exec.Execer) error {
+				switch repository {
+				case "repo1":
+					AttachValue(ctx, "answer", 42)
+					ReportFinding(ctx, Finding{RuleID: "R1", File: "main.go", Line: 3, Message: "bad"})
+				case "repo2":
+					return fmt.Errorf("%w: v2", errRefNotFound)
+				case "repo3":
+					return Skip("no go.mod")
+				}
+				return nil
+			}, RunOptions{})
+		require.NoError(t, err)
+
+		outcomes := outcomesByRepo(res)
+		require.Len(t, outcomes, 3)
+		require.Equal(t, OutcomeProcessed, outcomes["repo1"].Status)
+		require.Equal(t, map[string]any{"answer": 42}, outcomes["repo1"].Values)
+		require.Equal(t, []Finding{{Repository: "repo1", RuleID: "R1", Severity: SeverityWarning, File: "main.go", Line: 3, Message: "bad"}}, outcomes["repo1"].Findings)
+		require.Equal(t, outcomes["repo1"].Findings, res.Findings())
+		require.Equal(t, OutcomeSkipped, outcomes["repo2"].Status)
+		require.ErrorIs(t, outcomes["repo2"].Err, errRefNotFound)
+		require.Equal(t, SkipReasonRefNotFound, outcomes["repo2"].SkipReason)
+		require.Equal(t, OutcomeSkipped, outcomes["repo3"].Status)
+		require.Equal(t, "no go.mod", outcomes["repo3"].SkipReason)
+		require.Equal(t, 1, res.Processed)
+		require.Equal(t, 2, res.Skipped)
+		require.Equal(t, map[string]int{SkipReasonRefNotFound: 1, "no go.mod": 1}, res.SkipReasons)
+	})
+
+	t.Run("outcomes are returned on failure", func(t *testing.T) {
+		res, err := runForReposConcurrently(ctx, repoPages, 1, processAll, processorCaller,
+			func(ctx context.Context, repository string, isEmpty bool, xr exec.Execer) error {
+				if repository == "repo2" {
+					return errors.New("boom")
+				}
+				return nil
+			}, RunOptions{})
+		require.ErrorContains(t, err, "boom")
+
+		outcomes := outcomesByRepo(res)
+		require.Equal(t, OutcomeProcessed, outcomes["repo1"].Status)
+		require.Equal(t, OutcomeFailed, outcomes["repo2"].Status)
+	})
+}
+
+func TestRunForRepositoryOutcome(t *testing.T) {
+	repo := newTestRepository(t)
+
+	var outcome RepositoryOutcome
+	err := RunForRepository(context.Background(), repo.Name, func(ctx context.Context, repository string, isEmpty bool, xr exec.Execer) error {
+		ReportFinding(ctx, Finding{RuleID: "R1", File: "README.md", Message: "bad"})
+		return nil
+	}, RunOptions{
+		Client:                fakeClient{repoPages: [][]Repository{{repo}}},
+		SkipCloneabilityCheck: true,
+		Hooks: Hooks{
+			OnProgress: func(ctx context.Context, p Progress) {
+				require.Equal(t, 1, p.Done)
+				require.Equal(t, 1, p.Total)
+				outcome = p.Outcome
+			},
+		},
+	})
+	requireNoErrorAndPrintStderr(t, err)
+	require.Equal(t, OutcomeProcessed, outcome.Status)
+	require.Equal(t, []Finding{{Repository: repo.Name, RuleID: "R1", Severity: SeverityWarning, File: "README.md", Message: "bad"}}, outcome.Findings)
+}
+
+func TestAttachOutsideRun(t *testing.T) {
+	require.NotPanics(t, func() {
+		AttachValue(context.Background(), "key", "value")
+		ReportFinding(context.Background(), Finding{RuleID: "R1"})
+	})
+}
@@ -0,0 +1,38 @@
+package iterator
+
+import (
+	"context"
+
+	"github.com/jcchavezs/gh-iterator/github"
+)
+
+// Progress is the progress of a run, reported through Hooks.OnProgress once a repository is over.
+type Progress struct {
+	// Outcome is the outcome of the repository just over.
+	Outcome RepositoryOutcome
+	// Done is the number of repositories with an outcome so far, including the ones left out by
+	// the filtering.
+	Done int
+	// Total is the number of repositories found.
+	Total int
+	// RateLimit is the last known budget of the GitHub API client of the run, including the calls
+	// of the github helpers run by the processors, nil if unknown e.g. the client does not
+	// implement github.RateLimitReporter.
+	RateLimit *github.RateLimit
+}
+
+// rateLimitFromContext returns the last known budget of the client in the context if any.
+func rateLimitFromContext(ctx context.Context) *github.RateLimit {
+	c, _ := github.ClientFromContext(ctx)
+	r, ok := c.(github.RateLimitReporter)
+	if !ok {
+		return nil
+	}
+
+	rl, ok := r.RateLimit()
+	if !ok {
+		return nil
+	}
+
+	return &rl
+}
@@ -0,0 +1,43 @@
+package report
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+
+	iterator "github.com/jcchavezs/gh-iterator"
+)
+
+// WriteCSV writes a row per repository with a column per value attached by the processors.
+func WriteCSV(w io.Writer, res iterator.Result) error {
+	entries := Entries(res)
+	keys := valueKeys(entries)
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write(append([]string{"repository", "status", "skip_reason", "error", "duration_seconds", "attempts"}, keys...)); err != nil {
+		return fmt.Errorf("writing header: %w", err)
+	}
+
+	for _, e := range entries {
+		row := []string{
+			e.Repository,
+			e.Status,
+			e.SkipReason,
+			e.Error,
+			strconv.FormatFloat(e.Duration.Seconds(), 'f', 3, 64),
+			strconv.Itoa(e.Attempts),
+		}
+
+		for _, k := range keys {
+			row = append(row, formatValue(e.Values[k]))
+		}
+
+		if err := cw.Write(row); err != nil {
+			return fmt.Errorf("writing row for %q: %w", e.Repository, err)
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
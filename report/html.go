@@ -0,0 +1,33 @@
+package report
+
+import (
+	_ "embed"
+	"fmt"
+	"html/template"
+	"io"
+
+	iterator "github.com/jcchavezs/gh-iterator"
+)
+
+//go:embed report.html.tmpl
+var htmlTemplateContent string
+
+var htmlTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"value": func(e Entry, key string) string { return formatValue(e.Values[key]) },
+}).Parse(htmlTemplateContent))
+
+// WriteHTML writes a self-contained HTML page with a summary and a table with a row per repository.
+func WriteHTML(w io.Writer, res iterator.Result) error {
+	entries := Entries(res)
+
+	if err := htmlTemplate.Execute(w, struct {
+		Result  iterator.Result
+		Summary Summary
+		Keys    []string
+		Entries []Entry
+	}{res, summarize(entries), valueKeys(entries), entries}); err != nil {
+		return fmt.Errorf("rendering HTML report: %w", err)
+	}
+
+	return nil
+}
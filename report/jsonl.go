@@ -0,0 +1,27 @@
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	iterator "github.com/jcchavezs/gh-iterator"
+)
+
+// jsonEntry is the JSON representation of an entry with the duration in seconds.
+type jsonEntry struct {
+	Entry
+	DurationSeconds float64 `json:"duration_seconds"`
+}
+
+// WriteJSONLines writes one JSON object per repository.
+func WriteJSONLines(w io.Writer, res iterator.Result) error {
+	enc := json.NewEncoder(w)
+	for _, e := range Entries(res) {
+		if err := enc.Encode(jsonEntry{Entry: e, DurationSeconds: e.Duration.Seconds()}); err != nil {
+			return fmt.Errorf("encoding entry for %q: %w", e.Repository, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,59 @@
+package report
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	iterator "github.com/jcchavezs/gh-iterator"
+)
+
+// WriteMarkdown writes a summary and a table with a row per repository e.g. to be posted in
+// a GitHub issue.
+func WriteMarkdown(w io.Writer, res iterator.Result) error {
+	entries := Entries(res)
+	keys := valueKeys(entries)
+	summary := summarize(entries)
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "**%d** processed, **%d** skipped, **%d** failed", summary.Processed, summary.Skipped, summary.Failed)
+	if summary.Unscheduled > 0 {
+		fmt.Fprintf(&sb, ", **%d** unscheduled", summary.Unscheduled)
+	}
+	fmt.Fprintf(&sb, " out of %d repositories found.\n\n", res.Found)
+
+	header := append([]string{"Repository", "Status", "Skip reason", "Duration", "Attempts"}, keys...)
+	header = append(header, "Error")
+	writeMarkdownRow(&sb, header)
+
+	separators := make([]string, len(header))
+	for i := range separators {
+		separators[i] = "---"
+	}
+	writeMarkdownRow(&sb, separators)
+
+	for _, e := range entries {
+		row := []string{e.Repository, e.Status, e.SkipReason, e.Duration.String(), fmt.Sprint(e.Attempts)}
+		for _, k := range keys {
+			row = append(row, formatValue(e.Values[k]))
+		}
+		row = append(row, e.Error)
+
+		writeMarkdownRow(&sb, row)
+	}
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+var markdownCellReplacer = strings.NewReplacer("|", `\|`, "\r\n", "<br>", "\n", "<br>")
+
+func writeMarkdownRow(sb *strings.Builder, cells []string) {
+	sb.WriteString("|")
+	for _, c := range cells {
+		sb.WriteString(" ")
+		sb.WriteString(markdownCellReplacer.Replace(c))
+		sb.WriteString(" |")
+	}
+	sb.WriteString("\n")
+}
@@ -0,0 +1,115 @@
+// Package report renders the outcomes of a run in formats suitable to be shared e.g. JSON Lines
+// for further processing, CSV for spreadsheets, Markdown for GitHub issues or a self-contained
+// HTML page. The findings reported by the processors can be exported as SARIF and summarized
+// per rule.
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	iterator "github.com/jcchavezs/gh-iterator"
+)
+
+// Entry is the report entry of a repository.
+type Entry struct {
+	Repository string         `json:"repository"`
+	Status     string         `json:"status"`
+	SkipReason string         `json:"skip_reason,omitempty"`
+	Error      string         `json:"error,omitempty"`
+	Duration   time.Duration  `json:"-"`
+	Attempts   int            `json:"attempts"`
+	Values     map[string]any `json:"values,omitempty"`
+}
+
+// Entries returns the report entries for the outcomes of the run sorted by repository.
+func Entries(res iterator.Result) []Entry {
+	entries := make([]Entry, 0, len(res.Outcomes))
+	for _, o := range res.Outcomes {
+		e := Entry{
+			Repository: o.Repository,
+			Status:     o.Status.String(),
+			SkipReason: o.SkipReason,
+			Duration:   o.Duration.Round(time.Millisecond),
+			Attempts:   o.Attempts,
+			Values:     o.Values,
+		}
+
+		if o.Err != nil {
+			e.Error = o.Err.Error()
+		}
+
+		entries = append(entries, e)
+	}
+
+	slices.SortFunc(entries, func(a, b Entry) int {
+		return strings.Compare(a.Repository, b.Repository)
+	})
+
+	return entries
+}
+
+// Summary is the number of repositories by status.
+type Summary struct {
+	Processed, Skipped, Failed, Unscheduled int
+}
+
+func summarize(entries []Entry) Summary {
+	var s Summary
+	for _, e := range entries {
+		switch e.Status {
+		case iterator.OutcomeProcessed.String():
+			s.Processed++
+		case iterator.OutcomeSkipped.String():
+			s.Skipped++
+		case iterator.OutcomeFailed.String():
+			s.Failed++
+		case iterator.OutcomeUnscheduled.String():
+			s.Unscheduled++
+		}
+	}
+
+	return s
+}
+
+// valueKeys returns the sorted keys of the values attached to any of the entries.
+func valueKeys(entries []Entry) []string {
+	keys := map[string]struct{}{}
+	for _, e := range entries {
+		for k := range e.Values {
+			keys[k] = struct{}{}
+		}
+	}
+
+	return slices.Sorted(maps.Keys(keys))
+}
+
+// formatValue formats a value attached by the processor as text.
+func formatValue(v any) string {
+	switch tv := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return tv
+	case fmt.Stringer:
+		return tv.String()
+	case error:
+		return tv.Error()
+	case int:
+		return strconv.Itoa(tv)
+	case bool:
+		return strconv.FormatBool(tv)
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+
+	return string(b)
+}
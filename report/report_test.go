@@ -0,0 +1,175 @@
+package report
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	iterator "github.com/jcchavezs/gh-iterator"
+	"github.com/stretchr/testify/require"
+)
+
+var testResult = iterator.Result{
+	Found: 4,
+	Outcomes: []iterator.RepositoryOutcome{
+		{Repository: "my-org/repo-b", Status: iterator.OutcomeFailed, Err: errors.New("exit status 1\nmake: *** [build] | error"), Duration: 1500 * time.Millisecond, Attempts: 2},
+		{Repository: "my-org/repo-a", Status: iterator.OutcomeProcessed, Duration: 2 * time.Second, Attempts: 1, Values: map[string]any{"go_version": "1.24", "deps": 12}},
+		{Repository: "my-org/repo-c", Status: iterator.OutcomeSkipped, SkipReason: "ref not found", Err: errors.New("ref not found: v2")},
+	},
+}
+
+func TestWriteJSONLines(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, WriteJSONLines(&buf, testResult))
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 3)
+	require.JSONEq(t, `{"repository":"my-org/repo-a","status":"processed","attempts":1,"duration_seconds":2,"values":{"deps":12,"go_version":"1.24"}}`, lines[0])
+	require.JSONEq(t, `{"repository":"my-org/repo-b","status":"failed","error":"exit status 1\nmake: *** [build] | error","attempts":2,"duration_seconds":1.5}`, lines[1])
+}
+
+func TestWriteCSV(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, WriteCSV(&buf, testResult))
+
+	require.Equal(t, `repository,status,skip_reason,error,duration_seconds,attempts,deps,go_version
+my-org/repo-a,processed,,,2.000,1,12,1.24
+my-org/repo-b,failed,,"exit status 1
+make: *** [build] | error",1.500,2,,
+my-org/repo-c,skipped,ref not found,ref not found: v2,0.000,0,,
+`, buf.String())
+}
+
+func TestWriteMarkdown(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, WriteMarkdown(&buf, testResult))
+
+	require.Equal(t, `**1** processed, **1** skipped, **1** failed out of 4 repositories found.
+
+| Repository | Status | Skip reason | Duration | Attempts | deps | go_version | Error |
+| --- | --- | --- | --- | --- | --- | --- | --- |
+| my-org/repo-a | processed |  | 2s | 1 | 12 | 1.24 |  |
+| my-org/repo-b | failed |  | 1.5s | 2 |  |  | exit status 1<br>make: *** [build] \| error |
+| my-org/repo-c | skipped | ref not found | 0s | 0 |  |  | ref not found: v2 |
+`, buf.String())
+}
+
+func TestWriteHTML(t *testing.T) {
+	res := testResult
+	res.Outcomes = append(res.Outcomes, iterator.RepositoryOutcome{
+		Repository: "my-org/<script>",
+		Status:     iterator.OutcomeProcessed,
+	})
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteHTML(&buf, res))
+
+	html := buf.String()
+	require.Contains(t, html, "2 processed")
+	require.Contains(t, html, `<td class="failed">failed</td>`)
+	require.Contains(t, html, "<th>Skip reason</th>")
+	require.Contains(t, html, "<td>ref not found</td>")
+	require.Contains(t, html, "<th>go_version</th>")
+	require.Contains(t, html, "<td>1.24</td>")
+	require.Contains(t, html, "my-org/&lt;script&gt;")
+	require.NotContains(t, html, "my-org/<script>")
+}
+
+var findingsResult = iterator.Result{
+	Outcomes: []iterator.RepositoryOutcome{
+		{Repository: "my-org/repo-b", Findings: []iterator.Finding{
+			{Repository: "my-org/repo-b", RuleID: "GO-1", Severity: iterator.SeverityError, File: "go.mod", Line: 5, Message: "vulnerable module"},
+		}},
+		{Repository: "my-org/repo-a", Findings: []iterator.Finding{
+			{Repository: "my-org/repo-a", RuleID: "GO-1", Severity: iterator.SeverityWarning, File: "go.mod", Message: "vulnerable module"},
+			{Repository: "my-org/repo-a", RuleID: "no-readme", Severity: iterator.SeverityNote, Message: "missing README"},
+			{Repository: "my-org/repo-a", RuleID: "GO-1", Severity: iterator.SeverityWarning, File: "tools/go.mod", Message: "vulnerable module"},
+		}},
+	},
+}
+
+func TestRules(t *testing.T) {
+	require.Equal(t, []RuleSummary{
+		{RuleID: "GO-1", Severity: iterator.SeverityError, Findings: 3, Repositories: 2},
+		{RuleID: "no-readme", Severity: iterator.SeverityNote, Findings: 1, Repositories: 1},
+	}, Rules(findingsResult))
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteRuleSummary(&buf, findingsResult))
+	require.Equal(t, `| Rule | Severity | Findings | Repositories |
+| --- | --- | --- | --- |
+| GO-1 | error | 3 | 2 |
+| no-readme | note | 1 | 1 |
+`, buf.String())
+}
+
+func TestWriteSARIF(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, WriteSARIF(&buf, findingsResult))
+
+	require.JSONEq(t, `{
+		"version": "2.1.0",
+		"$schema": "https://json.schemastore.org/sarif-2.1.0.json",
+		"runs": [{
+			"tool": {"driver": {"name": "gh-iterator", "rules": [
+				{"id": "GO-1", "defaultConfiguration": {"level": "error"}},
+				{"id": "no-readme", "defaultConfiguration": {"level": "note"}}
+			]}},
+			"originalUriBaseIds": {
+				"my-org/repo-a": {"description": {"text": "Root of the my-org/repo-a repository"}},
+				"my-org/repo-b": {"description": {"text": "Root of the my-org/repo-b repository"}}
+			},
+			"results": [
+				{"ruleId": "no-readme", "ruleIndex": 1, "level": "note", "message": {"text": "missing README"}, "properties": {"repository": "my-org/repo-a"}},
+				{"ruleId": "GO-1", "ruleIndex": 0, "level": "warning", "message": {"text": "vulnerable module"}, "properties": {"repository": "my-org/repo-a"},
+					"locations": [{"physicalLocation": {"artifactLocation": {"uri": "go.mod", "uriBaseId": "my-org/repo-a"}}}]},
+				{"ruleId": "GO-1", "ruleIndex": 0, "level": "warning", "message": {"text": "vulnerable module"}, "properties": {"repository": "my-org/repo-a"},
+					"locations": [{"physicalLocation": {"artifactLocation": {"uri": "tools/go.mod", "uriBaseId": "my-org/repo-a"}}}]},
+				{"ruleId": "GO-1", "ruleIndex": 0, "level": "error", "message": {"text": "vulnerable module"}, "properties": {"repository": "my-org/repo-b"},
+					"locations": [{"physicalLocation": {"artifactLocation": {"uri": "go.mod", "uriBaseId": "my-org/repo-b"}, "region": {"startLine": 5}}}]}
+			]
+		}]
+	}`, buf.String())
+}
+
+func TestWriteSARIFWithoutRuleID(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, WriteSARIF(&buf, iterator.Result{
+		Outcomes: []iterator.RepositoryOutcome{
+			{Repository: "my-org/repo-a", Findings: []iterator.Finding{
+				{Repository: "my-org/repo-a", Severity: iterator.SeverityWarning, Message: "something is off"},
+				{Repository: "my-org/repo-a", RuleID: "unspecified", Severity: iterator.SeverityNote, Message: "something else is off"},
+			}},
+		},
+	}))
+
+	require.JSONEq(t, `{
+		"version": "2.1.0",
+		"$schema": "https://json.schemastore.org/sarif-2.1.0.json",
+		"runs": [{
+			"tool": {"driver": {"name": "gh-iterator", "rules": [
+				{"id": "unspecified", "defaultConfiguration": {"level": "warning"}}
+			]}},
+			"results": [
+				{"ruleId": "unspecified", "ruleIndex": 0, "level": "warning", "message": {"text": "something is off"}, "properties": {"repository": "my-org/repo-a"}},
+				{"ruleId": "unspecified", "ruleIndex": 0, "level": "note", "message": {"text": "something else is off"}, "properties": {"repository": "my-org/repo-a"}}
+			]
+		}]
+	}`, buf.String())
+}
+
+func TestWriteMarkdownUnscheduled(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, WriteMarkdown(&buf, iterator.Result{
+		Found: 2,
+		Outcomes: []iterator.RepositoryOutcome{
+			{Repository: "my-org/repo-a", Status: iterator.OutcomeProcessed},
+			{Repository: "my-org/repo-b", Status: iterator.OutcomeUnscheduled},
+		},
+	}))
+
+	require.True(t, strings.HasPrefix(buf.String(), "**1** processed, **0** skipped, **0** failed, **1** unscheduled out of 2 repositories found.\n"))
+	require.Contains(t, buf.String(), "| my-org/repo-b | unscheduled |")
+}
@@ -0,0 +1,88 @@
+package report
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	iterator "github.com/jcchavezs/gh-iterator"
+)
+
+// RuleSummary is the summary of the findings of a rule across all repositories.
+type RuleSummary struct {
+	RuleID string
+	// Severity is the highest severity of the findings of the rule.
+	Severity iterator.Severity
+	// Findings is the number of findings.
+	Findings int
+	// Repositories is the number of repositories with at least one finding.
+	Repositories int
+}
+
+var severityRank = map[iterator.Severity]int{
+	iterator.SeverityNote:    1,
+	iterator.SeverityWarning: 2,
+	iterator.SeverityError:   3,
+}
+
+// Rules returns the summary of the findings by rule sorted by severity, number of findings
+// and rule ID.
+func Rules(res iterator.Result) []RuleSummary {
+	var (
+		byRule = map[string]*RuleSummary{}
+		seen   = map[[2]string]struct{}{}
+	)
+
+	for _, f := range res.Findings() {
+		r, ok := byRule[f.RuleID]
+		if !ok {
+			r = &RuleSummary{RuleID: f.RuleID, Severity: f.Severity}
+			byRule[f.RuleID] = r
+		}
+
+		if severityRank[f.Severity] > severityRank[r.Severity] {
+			r.Severity = f.Severity
+		}
+
+		r.Findings++
+		if _, ok := seen[[2]string{f.RuleID, f.Repository}]; !ok {
+			seen[[2]string{f.RuleID, f.Repository}] = struct{}{}
+			r.Repositories++
+		}
+	}
+
+	rules := make([]RuleSummary, 0, len(byRule))
+	for _, r := range byRule {
+		rules = append(rules, *r)
+	}
+
+	slices.SortFunc(rules, func(a, b RuleSummary) int {
+		if c := severityRank[b.Severity] - severityRank[a.Severity]; c != 0 {
+			return c
+		}
+
+		if c := b.Findings - a.Findings; c != 0 {
+			return c
+		}
+
+		return strings.Compare(a.RuleID, b.RuleID)
+	})
+
+	return rules
+}
+
+// WriteRuleSummary writes a Markdown table with the number of findings and affected repositories
+// per rule.
+func WriteRuleSummary(w io.Writer, res iterator.Result) error {
+	var sb strings.Builder
+	writeMarkdownRow(&sb, []string{"Rule", "Severity", "Findings", "Repositories"})
+	writeMarkdownRow(&sb, []string{"---", "---", "---", "---"})
+
+	for _, r := range Rules(res) {
+		writeMarkdownRow(&sb, []string{r.RuleID, string(r.Severity), fmt.Sprint(r.Findings), fmt.Sprint(r.Repositories)})
+	}
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
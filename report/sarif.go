@@ -0,0 +1,162 @@
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	iterator "github.com/jcchavezs/gh-iterator"
+)
+
+const (
+	sarifVersion = "2.1.0"
+	sarifSchema  = "https://json.schemastore.org/sarif-2.1.0.json"
+	// sarifDefaultRuleID is the rule of the findings without RuleID as SARIF requires every
+	// result to reference a rule.
+	sarifDefaultRuleID = "unspecified"
+)
+
+type sarifLog struct {
+	Version string     `json:"version"`
+	Schema  string     `json:"$schema"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool               sarifTool                 `json:"tool"`
+	OriginalURIBaseIDs map[string]sarifURIBaseID `json:"originalUriBaseIds,omitempty"`
+	Results            []sarifResult             `json:"results"`
+}
+
+// sarifURIBaseID describes a uriBaseId. The location of the repositories is unknown hence
+// only their description is given.
+type sarifURIBaseID struct {
+	Description sarifMessage `json:"description"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name  string      `json:"name"`
+	Rules []sarifRule `json:"rules,omitempty"`
+}
+
+type sarifRule struct {
+	ID                   string             `json:"id"`
+	DefaultConfiguration sarifConfiguration `json:"defaultConfiguration"`
+}
+
+type sarifConfiguration struct {
+	Level string `json:"level"`
+}
+
+type sarifResult struct {
+	RuleID     string          `json:"ruleId"`
+	RuleIndex  int             `json:"ruleIndex"`
+	Level      string          `json:"level"`
+	Message    sarifMessage    `json:"message"`
+	Locations  []sarifLocation `json:"locations,omitempty"`
+	Properties sarifProperties `json:"properties"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           *sarifRegion          `json:"region,omitempty"`
+}
+
+type sarifArtifactLocation struct {
+	URI       string `json:"uri"`
+	URIBaseID string `json:"uriBaseId"`
+}
+
+type sarifRegion struct {
+	StartLine int `json:"startLine"`
+}
+
+type sarifProperties struct {
+	Repository string `json:"repository"`
+}
+
+// WriteSARIF writes the findings of all repositories as a single SARIF 2.1.0 log. The file of
+// every finding is located relative to its repository, which is used as uriBaseId, declared in
+// the run originalUriBaseIds and set in the result properties. Findings without RuleID are
+// reported under the "unspecified" rule.
+func WriteSARIF(w io.Writer, res iterator.Result) error {
+	run := sarifRun{
+		Tool:    sarifTool{Driver: sarifDriver{Name: "gh-iterator"}},
+		Results: []sarifResult{},
+	}
+
+	ruleIndex := map[string]int{}
+	for _, r := range Rules(res) {
+		id := sarifRuleID(r.RuleID)
+		if _, ok := ruleIndex[id]; ok {
+			// findings without RuleID share the rule with the ones reported as sarifDefaultRuleID
+			continue
+		}
+
+		ruleIndex[id] = len(run.Tool.Driver.Rules)
+		run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, sarifRule{
+			ID:                   id,
+			DefaultConfiguration: sarifConfiguration{Level: string(r.Severity)},
+		})
+	}
+
+	for _, f := range res.Findings() {
+		r := sarifResult{
+			RuleID:     sarifRuleID(f.RuleID),
+			RuleIndex:  ruleIndex[sarifRuleID(f.RuleID)],
+			Level:      string(f.Severity),
+			Message:    sarifMessage{Text: f.Message},
+			Properties: sarifProperties{Repository: f.Repository},
+		}
+
+		if f.File != "" {
+			if run.OriginalURIBaseIDs == nil {
+				run.OriginalURIBaseIDs = map[string]sarifURIBaseID{}
+			}
+
+			run.OriginalURIBaseIDs[f.Repository] = sarifURIBaseID{
+				Description: sarifMessage{Text: fmt.Sprintf("Root of the %s repository", f.Repository)},
+			}
+
+			l := sarifLocation{PhysicalLocation: sarifPhysicalLocation{
+				ArtifactLocation: sarifArtifactLocation{URI: f.File, URIBaseID: f.Repository},
+			}}
+			if f.Line > 0 {
+				l.PhysicalLocation.Region = &sarifRegion{StartLine: f.Line}
+			}
+
+			r.Locations = []sarifLocation{l}
+		}
+
+		run.Results = append(run.Results, r)
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(sarifLog{Version: sarifVersion, Schema: sarifSchema, Runs: []sarifRun{run}}); err != nil {
+		return fmt.Errorf("encoding SARIF log: %w", err)
+	}
+
+	return nil
+}
+
+// sarifRuleID returns the SARIF rule of the finding rule.
+func sarifRuleID(ruleID string) string {
+	if ruleID == "" {
+		return sarifDefaultRuleID
+	}
+
+	return ruleID
+}
@@ -0,0 +1,135 @@
+package iterator
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jcchavezs/gh-iterator/exec"
+	"github.com/jcchavezs/gh-iterator/github"
+	"github.com/jcchavezs/gh-iterator/internal/log"
+)
+
+// RetryOptions are the options to retry the network operations i.e. fetching the repositories
+// from the API and cloning them, when they fail due to transient errors.
+type RetryOptions struct {
+	// MaxAttempts is the maximum number of attempts including the first one, by default 3.
+	MaxAttempts int
+	// InitialBackoff is the wait before the first retry, by default 1s. It doubles on every retry
+	// with a random jitter.
+	InitialBackoff time.Duration
+	// MaxBackoff is the maximum wait between retries, by default 30s.
+	MaxBackoff time.Duration
+	// Classifier decides whether an error is transient hence worth to retry, by default IsTransientError.
+	Classifier func(error) bool
+}
+
+const (
+	defaultRetryMaxAttempts    = 3
+	defaultRetryInitialBackoff = time.Second
+	defaultRetryMaxBackoff     = 30 * time.Second
+)
+
+// transientErrorPatterns are the lowercased messages of errors caused by flaky networks or
+// unavailable servers as printed by git, gh and the Go HTTP client.
+var transientErrorPatterns = []string{
+	"connection reset",
+	"connection refused",
+	"connection timed out",
+	"i/o timeout",
+	"tls handshake timeout",
+	"early eof",
+	"unexpected disconnect",
+	"the remote end hung up unexpectedly",
+	"rpc failed",
+	"could not resolve host",
+	"temporary failure in name resolution",
+	"http 500",
+	"http 502",
+	"http 503",
+	"http 504",
+	"internal server error",
+	"bad gateway",
+	"service unavailable",
+	"gateway timeout",
+}
+
+// IsTransientError checks whether the error, or the stderr of the failed command, looks like a
+// transient failure e.g. a connection reset, an early EOF or a github.APIError with a 5xx status.
+// Context cancellations are never transient.
+func IsTransientError(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var apiErr *github.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode >= http.StatusInternalServerError
+	}
+
+	msg := strings.ToLower(err.Error())
+	if stderr, ok := exec.GetStderr(err); ok {
+		msg += "\n" + strings.ToLower(stderr)
+	}
+
+	for _, p := range transientErrorPatterns {
+		if strings.Contains(msg, p) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// retry runs fn until it succeeds, fails with a permanent error or the attempts are exhausted.
+// The attempts are recorded in the repository stats in the context if any.
+func retry(ctx context.Context, opts *RetryOptions, operation string, fn func() error) error {
+	maxAttempts, initialBackoff, maxBackoff, isTransient := 1, defaultRetryInitialBackoff, defaultRetryMaxBackoff, IsTransientError
+	if opts != nil {
+		maxAttempts = defaultRetryMaxAttempts
+		if opts.MaxAttempts > 0 {
+			maxAttempts = opts.MaxAttempts
+		}
+
+		if opts.InitialBackoff > 0 {
+			initialBackoff = opts.InitialBackoff
+		}
+
+		if opts.MaxBackoff > 0 {
+			maxBackoff = opts.MaxBackoff
+		}
+
+		if opts.Classifier != nil {
+			isTransient = opts.Classifier
+		}
+	}
+
+	stats := repoStatsFromContext(ctx)
+	backoff := initialBackoff
+
+	for attempt := 1; ; attempt++ {
+		stats.recordAttempt(attempt)
+
+		err := fn()
+		if err == nil || attempt >= maxAttempts || !isTransient(err) {
+			return err
+		}
+
+		// full jitter on the upper half to avoid retrying in lockstep
+		wait := backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+		log.FromCtx(ctx).Warn("Transient failure, retrying", "operation", operation, "attempt", attempt, "retry_in", wait, "error", err)
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return errors.Join(err, ctx.Err())
+		case <-timer.C:
+		}
+
+		backoff = min(backoff*2, maxBackoff)
+	}
+}
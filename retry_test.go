@@ -0,0 +1,143 @@
+package iterator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/jcchavezs/gh-iterator/exec"
+	"github.com/jcchavezs/gh-iterator/github"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsTransientError(t *testing.T) {
+	testCases := map[string]struct {
+		err       error
+		transient bool
+	}{
+		"nil":                  {err: nil, transient: false},
+		"context cancelled":    {err: fmt.Errorf("fetching: %w", context.Canceled), transient: false},
+		"connection reset":     {err: errors.New("read tcp: connection reset by peer"), transient: true},
+		"early EOF in stderr":  {err: exec.NewExecErr("exit status 128", "fatal: early EOF\nfatal: index-pack failed", 128), transient: true},
+		"server error from gh": {err: exec.NewExecErr("exit status 1", "gh: Bad Gateway (HTTP 502)", 1), transient: true},
+		"api server error":     {err: fmt.Errorf("fetching: %w", &github.APIError{StatusCode: 503}), transient: true},
+		"api not found":        {err: fmt.Errorf("fetching: %w", &github.APIError{StatusCode: 404}), transient: false},
+		"missing ref":          {err: exec.NewExecErr("exit status 128", "fatal: couldn't find remote ref v2", 128), transient: false},
+		"authentication":       {err: exec.NewExecErr("exit status 128", "fatal: Authentication failed", 128), transient: false},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			require.Equal(t, tc.transient, IsTransientError(tc.err))
+		})
+	}
+}
+
+func TestRetry(t *testing.T) {
+	ctx := context.Background()
+	transientErr := errors.New("connection reset by peer")
+	retryOpts := &RetryOptions{MaxAttempts: 3, InitialBackoff: time.Millisecond}
+
+	t.Run("no policy", func(t *testing.T) {
+		var calls int
+		err := retry(ctx, nil, "test", func() error {
+			calls++
+			return transientErr
+		})
+		require.ErrorIs(t, err, transientErr)
+		require.Equal(t, 1, calls)
+	})
+
+	t.Run("succeeds after transient failures", func(t *testing.T) {
+		stats := &repoStats{}
+		var calls int
+		err := retry(context.WithValue(ctx, repoStatsKey{}, stats), retryOpts, "test", func() error {
+			calls++
+			if calls < 3 {
+				return transientErr
+			}
+			return nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, 3, calls)
+		require.Equal(t, 3, stats.getAttempts())
+	})
+
+	t.Run("gives up after max attempts", func(t *testing.T) {
+		var calls int
+		err := retry(ctx, retryOpts, "test", func() error {
+			calls++
+			return transientErr
+		})
+		require.ErrorIs(t, err, transientErr)
+		require.Equal(t, 3, calls)
+	})
+
+	t.Run("does not retry permanent errors", func(t *testing.T) {
+		permanentErr := errors.New("repository not found")
+		var calls int
+		err := retry(ctx, retryOpts, "test", func() error {
+			calls++
+			return permanentErr
+		})
+		require.ErrorIs(t, err, permanentErr)
+		require.Equal(t, 1, calls)
+	})
+
+	t.Run("custom classifier", func(t *testing.T) {
+		var calls int
+		err := retry(ctx, &RetryOptions{
+			MaxAttempts:    2,
+			InitialBackoff: time.Millisecond,
+			Classifier:     func(error) bool { return true },
+		}, "test", func() error {
+			calls++
+			return errors.New("anything")
+		})
+		require.Error(t, err)
+		require.Equal(t, 2, calls)
+	})
+
+	t.Run("stops on context cancellation", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(ctx)
+		var calls int
+		err := retry(ctx, &RetryOptions{MaxAttempts: 3, InitialBackoff: time.Hour}, "test", func() error {
+			calls++
+			cancel()
+			return transientErr
+		})
+		require.ErrorIs(t, err, context.Canceled)
+		require.Equal(t, 1, calls)
+	})
+}
+
+func TestRunForReposConcurrentlyOutcomeAttempts(t *testing.T) {
+	repoPages := [][]Repository{{{Name: "repo1"}, {Name: "repo2"}}}
+
+	var repo1Calls int
+	processorCaller := func(ctx context.Context, repo Repository, processor Processor, opts RunOptions) error {
+		return retry(ctx, opts.Retry, "cloning", func() error {
+			if repo.Name == "repo1" {
+				repo1Calls++
+				if repo1Calls == 1 {
+					return errors.New("fatal: early EOF")
+				}
+			}
+
+			return nil
+		})
+	}
+
+	res, err := runForReposConcurrently(context.Background(), repoPages, 1, processAll, processorCaller, nil, RunOptions{
+		Retry: &RetryOptions{InitialBackoff: time.Millisecond},
+	})
+	require.NoError(t, err)
+
+	attempts := map[string]int{}
+	for _, o := range res.Outcomes {
+		attempts[o.Repository] = o.Attempts
+	}
+	require.Equal(t, map[string]int{"repo1": 2, "repo2": 1}, attempts)
+}
@@ -0,0 +1,57 @@
+package iterator
+
+import (
+	"errors"
+)
+
+// ErrSkip is returned by a processor to skip the repository instead of failing the run. Use Skip
+// to give the reason, which is counted in Result.SkipReasons and set in the outcome.
+var ErrSkip = errors.New("skipped")
+
+// SkipError is the error to skip a repository with a reason. It matches ErrSkip.
+type SkipError struct {
+	Reason string
+}
+
+func (e *SkipError) Error() string {
+	return e.Reason
+}
+
+func (e *SkipError) Is(target error) bool {
+	return target == ErrSkip
+}
+
+// Skip returns an error to skip the repository for the reason e.g. "no go.mod". Reasons are
+// counted as is hence they should not include repository specific details.
+func Skip(reason string) error {
+	return &SkipError{Reason: reason}
+}
+
+// SkipReason returns the reason to skip the repository if the error matches ErrSkip.
+func SkipReason(err error) (string, bool) {
+	var skipErr *SkipError
+	if errors.As(err, &skipErr) {
+		return skipErr.Reason, true
+	}
+
+	if errors.Is(err, ErrSkip) {
+		return err.Error(), true
+	}
+
+	return "", false
+}
+
+// Skip reasons of the repositories left out by the SearchOptions or that can't be checked out.
+const (
+	SkipReasonFilteredOut     = "filtered out"
+	SkipReasonLanguage        = "language"
+	SkipReasonArchived        = "archived"
+	SkipReasonNotArchived     = "not archived"
+	SkipReasonFork            = "fork"
+	SkipReasonNotFork         = "not a fork"
+	SkipReasonVisibility      = "visibility"
+	SkipReasonEmpty           = "empty"
+	SkipReasonNotEmpty        = "not empty"
+	SkipReasonNoDefaultBranch = "no default branch"
+	SkipReasonRefNotFound     = "ref not found"
+)
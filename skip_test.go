@@ -0,0 +1,46 @@
+package iterator
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSkipReason(t *testing.T) {
+	testCases := map[string]struct {
+		err    error
+		reason string
+		skip   bool
+	}{
+		"nil":              {err: nil},
+		"failure":          {err: errors.New("boom")},
+		"skip":             {err: Skip("no go.mod"), reason: "no go.mod", skip: true},
+		"wrapped skip":     {err: fmt.Errorf("checking: %w", Skip("no go.mod")), reason: "no go.mod", skip: true},
+		"sentinel":         {err: ErrSkip, reason: "skipped", skip: true},
+		"wrapped sentinel": {err: fmt.Errorf("%w: vendored", ErrSkip), reason: "skipped: vendored", skip: true},
+		"ref not found":    {err: fmt.Errorf("%w: v2", errRefNotFound), reason: SkipReasonRefNotFound, skip: true},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			reason, skip := SkipReason(tc.err)
+			require.Equal(t, tc.skip, skip)
+			require.Equal(t, tc.reason, reason)
+		})
+	}
+}
+
+func TestMakeSkipReason(t *testing.T) {
+	skipReason := SearchOptions{
+		ArchiveCondition: OmitArchived,
+		SizeCondition:    NotEmpty,
+		FilterIn:         func(r Repository) bool { return r.Name != "my-org/excluded" },
+	}.makeSkipReason()
+
+	require.Equal(t, "", skipReason(Repository{Name: "my-org/repo", Size: 1}))
+	require.Equal(t, SkipReasonArchived, skipReason(Repository{Name: "my-org/repo", Size: 1, Archived: true}))
+	require.Equal(t, SkipReasonEmpty, skipReason(Repository{Name: "my-org/repo"}))
+	require.Equal(t, SkipReasonFilteredOut, skipReason(Repository{Name: "my-org/excluded", Size: 1}))
+}
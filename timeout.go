@@ -0,0 +1,60 @@
+package iterator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	// ErrRepoTimeout is returned when cloning and processing a repository exceeds Options.RepoTimeout.
+	ErrRepoTimeout = errors.New("repository timed out")
+	// ErrTimeBudgetExceeded is returned when the run exceeds Options.TimeBudget and some
+	// repositories were not scheduled.
+	ErrTimeBudgetExceeded = errors.New("time budget exceeded")
+)
+
+// withRepoTimeout returns the context to clone and process a repository bounded by the timeout
+// if any.
+func withRepoTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return ctx, func() {}
+	}
+
+	return context.WithTimeout(ctx, timeout)
+}
+
+// repoTimeoutErr wraps the error with ErrRepoTimeout if the repository context timed out while
+// the run context is still alive. Commands killed by the timeout fail with errors like
+// "signal: killed" hence the context is checked rather than the error.
+func repoTimeoutErr(ctx, repoCtx context.Context, timeout time.Duration, err error) error {
+	if err == nil || ctx.Err() != nil || !errors.Is(repoCtx.Err(), context.DeadlineExceeded) {
+		return err
+	}
+
+	return fmt.Errorf("%w after %s: %w", ErrRepoTimeout, timeout, err)
+}
+
+type timeBudgetKey struct{}
+
+// withTimeBudget starts the time budget of the run, hence it includes fetching the repositories
+// and the cloneability check, and returns the context carrying it with a function to release
+// the timer.
+func withTimeBudget(ctx context.Context, budget time.Duration) (context.Context, func()) {
+	if budget <= 0 {
+		return ctx, func() {}
+	}
+
+	exceededC := make(chan struct{})
+	t := time.AfterFunc(budget, func() { close(exceededC) })
+
+	return context.WithValue(ctx, timeBudgetKey{}, (<-chan struct{})(exceededC)), func() { t.Stop() }
+}
+
+// timeBudgetExceeded returns a channel closed once the time budget of the run is exceeded, or a
+// nil channel if there is no budget.
+func timeBudgetExceeded(ctx context.Context) <-chan struct{} {
+	exceededC, _ := ctx.Value(timeBudgetKey{}).(<-chan struct{})
+	return exceededC
+}
@@ -0,0 +1,77 @@
+package iterator
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jcchavezs/gh-iterator/exec"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunForReposConcurrentlyRepoTimeout(t *testing.T) {
+	repoPages := [][]Repository{{{Name: "repo1"}, {Name: "repo2"}}}
+
+	startedAt := time.Now()
+	res, err := runForReposConcurrently(context.Background(), repoPages, 2, processAll, func(ctx context.Context, repo Repository, processor Processor, opts RunOptions) error {
+		if repo.Name == "repo2" {
+			_, err := exec.NewExecer("").RunX(ctx, "sleep", "10")
+			return err
+		}
+		return nil
+	}, nil, RunOptions{RepoTimeout: 100 * time.Millisecond, ErrorPolicy: ContinueOnError})
+	require.ErrorIs(t, err, ErrRepoTimeout)
+	require.Less(t, time.Since(startedAt), 5*time.Second)
+
+	statuses := map[string]OutcomeStatus{}
+	for _, o := range res.Outcomes {
+		statuses[o.Repository] = o.Status
+	}
+	require.Equal(t, map[string]OutcomeStatus{"repo1": OutcomeProcessed, "repo2": OutcomeFailed}, statuses)
+}
+
+func TestRunForReposConcurrentlyTimeBudget(t *testing.T) {
+	repoPages := [][]Repository{{{Name: "repo1"}, {Name: "repo2"}, {Name: "repo3"}, {Name: "repo4"}}}
+
+	ctx, stopBudget := withTimeBudget(context.Background(), 50*time.Millisecond)
+	defer stopBudget()
+
+	res, err := runForReposConcurrently(ctx, repoPages, 1, processAll, func(ctx context.Context, repo Repository, processor Processor, opts RunOptions) error {
+		if repo.Name == "repo1" {
+			time.Sleep(200 * time.Millisecond)
+		}
+		return nil
+	}, nil, RunOptions{TimeBudget: 50 * time.Millisecond})
+	require.ErrorIs(t, err, ErrTimeBudgetExceeded)
+
+	statuses := map[string]OutcomeStatus{}
+	for _, o := range res.Outcomes {
+		statuses[o.Repository] = o.Status
+	}
+
+	// repo2 is already queued for the only worker when the budget is exceeded
+	require.Equal(t, map[string]OutcomeStatus{
+		"repo1": OutcomeProcessed,
+		"repo2": OutcomeProcessed,
+		"repo3": OutcomeUnscheduled,
+		"repo4": OutcomeUnscheduled,
+	}, statuses)
+	require.Equal(t, 2, res.Unscheduled)
+	require.Equal(t, 2, res.Processed)
+}
+
+func TestTimeBudgetIncludesListing(t *testing.T) {
+	repo := newTestRepository(t)
+
+	var processed bool
+	_, err := RunForOrganization(context.Background(), "my-org", SearchOptions{}, func(ctx context.Context, repository string, isEmpty bool, xr exec.Execer) error {
+		processed = true
+		return nil
+	}, RunOptions{
+		Client:                fakeClient{repoPages: [][]Repository{{repo}}, delay: 100 * time.Millisecond},
+		SkipCloneabilityCheck: true,
+		TimeBudget:            50 * time.Millisecond,
+	})
+	require.ErrorIs(t, err, ErrTimeBudgetExceeded)
+	require.False(t, processed)
+}
@@ -0,0 +1,124 @@
+package iterator
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/jcchavezs/gh-iterator/exec"
+	"github.com/jcchavezs/gh-iterator/internal/log"
+)
+
+// addWorktree checks out the commitish in dir as a worktree of the repository in xr, applying
+// the cloning subset, submodules and LFS options. Extra args are passed to `git worktree add`
+// e.g. "--detach".
+func addWorktree(ctx context.Context, xr exec.Execer, dir, commitish string, opts RunOptions, extraArgs ...string) error {
+	args := append([]string{"worktree", "add"}, extraArgs...)
+	if len(opts.CloningSubset) > 0 {
+		args = append(args, "--no-checkout")
+	}
+
+	if _, err := xr.RunX(ctx, "git", append(args, dir, commitish)...); err != nil {
+		return fmt.Errorf("adding worktree: %w", err)
+	}
+
+	wxr := newCloneExecer(dir, log.FromCtx(ctx), opts.Auth, opts.Host)
+	if len(opts.CloningSubset) > 0 {
+		if err := checkoutWorktreeSubset(ctx, wxr, opts.CloningSubset); err != nil {
+			return err
+		}
+	}
+
+	return completeCheckout(ctx, wxr, opts)
+}
+
+// completeCheckoutFromClone checks out the submodules and LFS objects in the worktree or shared
+// clone wxr of the clone in cxr according to opts, reusing the ones already fetched in the clone rather than
+// fetching them again from the remotes.
+func completeCheckoutFromClone(ctx context.Context, cxr, wxr exec.Execer, opts RunOptions) error {
+	if opts.Submodules != SubmodulesNone {
+		foreachArgs := []string{"submodule", "foreach", "--quiet"}
+		if opts.Submodules == SubmodulesRecursive {
+			foreachArgs = append(foreachArgs, "--recursive")
+		}
+
+		modules, err := cxr.RunX(ctx, "git", append(foreachArgs, `printf '%s\t%s\n' "$name" "$(git rev-parse --absolute-git-dir)"`)...)
+		if err != nil {
+			return withStderr("listing cached submodules", err)
+		}
+
+		// the submodules are cloned from the git directories of the clone ones, which are local
+		args := []string{"-c", "protocol.file.allow=always"}
+		for _, line := range strings.Split(strings.TrimSpace(modules), "\n") {
+			if name, gitDir, ok := strings.Cut(line, "\t"); ok {
+				args = append(args, "-c", fmt.Sprintf("submodule.%s.url=%s", name, gitDir))
+			}
+		}
+
+		args = append(args, "submodule", "update", "--init")
+		if opts.Submodules == SubmodulesRecursive {
+			args = append(args, "--recursive")
+		}
+
+		if _, err := wxr.RunX(ctx, "git", args...); err != nil {
+			return withStderr("checking out submodules", err)
+		}
+	}
+
+	if opts.LFS == LFSSkip {
+		return nil
+	}
+
+	// worktrees and shared clones share the LFS objects of the clone hence they only need to be
+	// checked out
+	args := []string{"lfs", "checkout"}
+	if opts.LFS == LFSPullSubset {
+		args = append(args, opts.CloningSubset...)
+	}
+
+	if _, err := wxr.RunX(ctx, "git", args...); err != nil {
+		return withStderr("checking out LFS objects", err)
+	}
+
+	return nil
+}
+
+// checkoutWorktreeSubset checks out the cloning subset in a worktree added or a repository cloned
+// with --no-checkout.
+func checkoutWorktreeSubset(ctx context.Context, wxr exec.Execer, subset []string) error {
+	// sparse checkout patterns are stored per worktree
+	sparseFile, err := exec.TrimStdout(wxr.RunX(ctx, "git", "rev-parse", "--path-format=absolute", "--git-path", "info/sparse-checkout"))
+	if err != nil {
+		return fmt.Errorf("locating sparse checkout file: %w", err)
+	}
+
+	if err := os.MkdirAll(path.Dir(sparseFile), os.ModePerm); err != nil {
+		return fmt.Errorf("creating sparse checkout directory: %w", err)
+	}
+
+	if err := fillLines(sparseFile, subset); err != nil {
+		return fmt.Errorf("setting cloning subset: %w", err)
+	}
+
+	if _, err := wxr.RunX(ctx, "git", "reset", "--hard", "--quiet"); err != nil {
+		return fmt.Errorf("checking out cloning subset: %w", err)
+	}
+
+	return nil
+}
+
+// removeWorktree removes the worktree in dir from the repository in xr. If git fails to
+// remove it, the directory is removed and the stale worktree metadata pruned.
+func removeWorktree(ctx context.Context, xr exec.Execer, dir string) {
+	if _, err := xr.RunX(ctx, "git", "worktree", "remove", "--force", dir); err == nil {
+		return
+	}
+
+	if err := os.RemoveAll(dir); err != nil {
+		log.FromCtx(ctx).Warn("Failed to remove the worktree directory", "error", err)
+	}
+
+	_, _ = xr.RunX(ctx, "git", "worktree", "prune")
+}